@@ -12,12 +12,16 @@ import (
 var (
 	configFile string
 	debug      bool
+	dryRun     bool
+	listImages bool
 	Version    string
 )
 
 func main() {
 	flag.StringVar(&configFile, "config", "config.yaml", "Path to config file")
 	flag.BoolVar(&debug, "debug", false, "Debug mode")
+	flag.BoolVar(&dryRun, "dry-run", false, "Print the planned checks and objects without creating them")
+	flag.BoolVar(&listImages, "list-images", false, "List container images needed by the validation run")
 	flag.Parse()
 
 	if debug {
@@ -28,6 +32,8 @@ func main() {
 
 	v := &validation.ValidationRun{
 		ConfigFile: configFile,
+		DryRun:     dryRun,
+		ListImages: listImages,
 		Version:    Version,
 	}
 
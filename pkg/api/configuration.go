@@ -1,13 +1,32 @@
 package api
 
+import corev1 "k8s.io/api/core/v1"
+
 type Configuration struct {
 	// Namespace to run checks in. Else use default from current context
 	Namespace string `json:"namespace,omitempty"`
 
 	// ImageURL to use to create a virtualmachineimage.
-	// required to ensure check can be triggered
+	// required to ensure check can be triggered, unless ImageFile is specified
 	ImageURL string `json:"imageURL"`
 
+	// ImageFile is a local qcow2 or raw image, served to the cluster over a temporary
+	// http endpoint and used to create the virtualmachineimage instead of ImageURL
+	ImageFile string `json:"imageFile,omitempty"`
+
+	// ImageChecksum is an optional sha512 checksum of the image. it is verified locally
+	// before ImageFile is served, and set on the vmimage for harvester to verify the import
+	ImageChecksum string `json:"imageChecksum,omitempty"`
+
+	// ImageVerification configures the properties expected of the imported vmimage
+	ImageVerification ImageVerificationSpec `json:"imageVerification,omitempty"`
+
+	// ImageServer configures the http endpoint used to serve ImageFile
+	ImageServer ImageServerSpec `json:"imageServer,omitempty"`
+
+	// ImageSources configures validation of additional vmimage source types
+	ImageSources ImageSourcesSpec `json:"imageSources,omitempty"`
+
 	// StorageClass to be used for storagechecks
 	StorageClass string `json:"storageClass,omitempty"`
 
@@ -20,10 +39,147 @@ type Configuration struct {
 	SkipCleanup *bool `json:"skipCleanup,omitempty"`
 	// Timeout represents time duration in seconds to wait before triggering cleanup
 	Timeout *int `json:"timeout,omitempty"`
+	// Workload overrides the pods created to exercise volumes, useful for air-gapped clusters
+	Workload WorkloadSpec `json:"workload,omitempty"`
+	// Migration configures the vm live migration checks
+	Migration MigrationSpec `json:"migration,omitempty"`
+	// Hotplug configures the hotplug volume checks
+	Hotplug HotplugSpec `json:"hotplug,omitempty"`
+	// Scale configures the parallel vm provisioning check
+	Scale ScaleSpec `json:"scale,omitempty"`
+	// Soak configures the endurance check, which repeats vm lifecycle operations
+	Soak SoakSpec `json:"soak,omitempty"`
+	// UnsupportedFeatures of the storage class, any of snapshot, volumeExpansion and rwx. checks
+	// depending on them are reported as not-applicable rather than failing the run
+	UnsupportedFeatures []string `json:"unsupportedFeatures,omitempty"`
+	// Chaos configures the optional failure injection checks
+	Chaos ChaosSpec `json:"chaos,omitempty"`
+	// Benchmark configures the optional fio performance benchmark of StorageClass
+	Benchmark BenchmarkSpec `json:"benchmark,omitempty"`
 }
 
 type VMSpec struct {
 	CPU      uint32 `json:"cpu,omitempty"`
 	Memory   string `json:"ram,omitempty"`
 	DiskSize string `json:"diskSize,omitempty"`
+	// GuestUser and GuestPassword are set through cloud-init, and used to run commands
+	// in the guest over the serial console. a random password is generated when not specified
+	GuestUser     string `json:"guestUser,omitempty"`
+	GuestPassword string `json:"guestPassword,omitempty"`
+}
+
+type ImageServerSpec struct {
+	// ListenAddress of the http server, defaults to a random port on all interfaces
+	ListenAddress string `json:"listenAddress,omitempty"`
+	// AdvertiseAddress is the host or ip of the validator reachable from cluster nodes,
+	// defaults to the local address used to reach the apiserver
+	AdvertiseAddress string `json:"advertiseAddress,omitempty"`
+}
+
+type ImageVerificationSpec struct {
+	// Format expected of the source image, either qcow2 or raw
+	Format string `json:"format,omitempty"`
+	// Size in bytes expected to be reported in the vmimage status
+	Size int64 `json:"size,omitempty"`
+	// VirtualSize in bytes expected to be reported in the vmimage status,
+	// detected from the header of the source image when not specified
+	VirtualSize int64 `json:"virtualSize,omitempty"`
+}
+
+type ImageSourcesSpec struct {
+	// HarvesterURL of the harvester api used to upload images, derived from the kubeconfig
+	// when it is downloaded from the harvester ui
+	HarvesterURL string `json:"harvesterURL,omitempty"`
+	// HarvesterToken is the bearer token used to authenticate with HarvesterURL when it is not
+	// served on the host of the kubeconfig, whose credentials are only sent to that host
+	HarvesterToken string `json:"harvesterToken,omitempty"`
+	// CloneStorageClass is an encrypted storage class used as target when cloning images.
+	// image clone checks are skipped when not specified
+	CloneStorageClass string `json:"cloneStorageClass,omitempty"`
+}
+
+type WorkloadSpec struct {
+	// Image used by probe pods which mount volumes under validation
+	Image string `json:"image,omitempty"`
+	// ImagePullSecrets in the validation namespace used to pull Image
+	ImagePullSecrets []string `json:"imagePullSecrets,omitempty"`
+	// NodeSelector and Tolerations applied to probe pods
+	NodeSelector map[string]string   `json:"nodeSelector,omitempty"`
+	Tolerations  []corev1.Toleration `json:"tolerations,omitempty"`
+	// Resources requested by probe pods
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+}
+
+type MigrationSpec struct {
+	// RoundRobin migrates the vm through every ready and schedulable node, and
+	// reports the result of every hop in a migration matrix
+	RoundRobin bool `json:"roundRobin,omitempty"`
+	// MonitorIO runs continuous writes in the guest to the boot disk and a hotplugged disk
+	// during the live migration, to measure the io stall and verify no writes are lost
+	MonitorIO bool `json:"monitorIO,omitempty"`
+	// MaxIOStallSeconds fails the migration when writes stall for longer, ignored when zero
+	MaxIOStallSeconds float64 `json:"maxIOStallSeconds,omitempty"`
+}
+
+type HotplugSpec struct {
+	// Buses used to hotplug block and filesystem mode volumes, defaults to scsi and virtio
+	Buses []string `json:"buses,omitempty"`
+	// MaxVolumes hotplugged by the scale check, which stops at the first volume failing
+	// to attach. the scale check is skipped when not specified
+	MaxVolumes int `json:"maxVolumes,omitempty"`
+	// AttachTimeout in seconds to wait for each volume of the scale check to attach
+	AttachTimeout int `json:"attachTimeout,omitempty"`
+}
+
+type ScaleSpec struct {
+	// VMCount provisioned and booted in parallel from the vmimage, the check is skipped when not specified
+	VMCount int `json:"vmCount,omitempty"`
+}
+
+const (
+	FeatureSnapshot        = "snapshot"
+	FeatureVolumeExpansion = "volumeExpansion"
+	FeatureRWX             = "rwx"
+)
+
+type ChaosSpec struct {
+	// RestartCSINodePlugin restarts the csi node plugin pod on the node hosting the vm
+	// while io is in progress, to ensure running workloads survive driver upgrades
+	RestartCSINodePlugin bool `json:"restartCSINodePlugin,omitempty"`
+}
+
+type SoakSpec struct {
+	// Operations repeated in every iteration, any of migration, hotplug, snapshot and
+	// stopStart. defaults to all operations
+	Operations []string `json:"operations,omitempty"`
+	// Duration in seconds to repeat the operations for, which extends the run timeout
+	Duration int `json:"duration,omitempty"`
+	// Iterations to run, the soak check is skipped when neither Duration nor Iterations is specified
+	Iterations int `json:"iterations,omitempty"`
+}
+
+type BenchmarkSpec struct {
+	// Enabled runs the fio benchmark, which is skipped by default
+	Enabled bool `json:"enabled,omitempty"`
+	// Image containing the fio binary used by benchmark pods, which should be pinned by digest.
+	// there is no default, and the benchmark is skipped if it is not specified
+	Image string `json:"image,omitempty"`
+	// Size of the volumes created for the benchmark, the test file uses most of the volume
+	Size string `json:"size,omitempty"`
+	// Runtime in seconds of each fio job
+	Runtime int `json:"runtime,omitempty"`
+	// InVM additionally runs fio inside the validation vm, requires fio in the guest image
+	InVM bool `json:"inVM,omitempty"`
+	// Thresholds by storage class name, which fail the benchmark when not met
+	Thresholds map[string]BenchmarkThresholds `json:"thresholds,omitempty"`
+}
+
+// BenchmarkThresholds are evaluated against every benchmark target, zero values are ignored
+type BenchmarkThresholds struct {
+	MinRandReadIOPS          float64 `json:"minRandReadIOPS,omitempty"`
+	MinRandWriteIOPS         float64 `json:"minRandWriteIOPS,omitempty"`
+	MinSeqReadMiBps          float64 `json:"minSeqReadMiBps,omitempty"`
+	MinSeqWriteMiBps         float64 `json:"minSeqWriteMiBps,omitempty"`
+	MaxRandReadLatencyP99Ms  float64 `json:"maxRandReadLatencyP99Ms,omitempty"`
+	MaxRandWriteLatencyP99Ms float64 `json:"maxRandWriteLatencyP99Ms,omitempty"`
 }
@@ -3,19 +3,221 @@ package api
 type Report struct {
 	EnvironmentInfo `json:"environmentInfo"`
 	Configuration   `json:"inputConfiguration"`
-	Results         []Result `json:"results"`
+	Preflight       []Result            `json:"preflight,omitempty"`
+	Results         []Result            `json:"results"`
+	Benchmarks      []BenchmarkResult   `json:"benchmarks,omitempty"`
+	MigrationMatrix []MigrationResult   `json:"migrationMatrix,omitempty"`
+	MigrationIO     *MigrationIOResult  `json:"migrationIO,omitempty"`
+	HotplugScale    *HotplugScaleResult `json:"hotplugScale,omitempty"`
+	VMScale         *VMScaleResult      `json:"vmScale,omitempty"`
+	Soak            *SoakResult         `json:"soak,omitempty"`
+	Failover        *FailoverResult     `json:"failover,omitempty"`
+	NodeMatrix      []NodeProbeResult   `json:"nodeMatrix,omitempty"`
+	VolumeProbes    []VolumeProbeResult `json:"volumeProbes,omitempty"`
+	StorageAudit    *StorageAuditResult `json:"storageAudit,omitempty"`
+	Capabilities    map[string]bool     `json:"capabilities,omitempty"`
 }
 
 type Result struct {
-	Name   string      `json:"name"`
-	Status CheckStatus `json:"status"`
-	Info   string      `json:"info,omitempty"`
+	Name        string              `json:"name"`
+	Status      CheckStatus         `json:"status"`
+	Info        string              `json:"info,omitempty"`
+	Diagnostics []ObjectDiagnostics `json:"diagnostics,omitempty"`
+}
+
+// ObjectDiagnostics captures the last known state of an object involved in a failed check
+type ObjectDiagnostics struct {
+	Kind          string   `json:"kind"`
+	Name          string   `json:"name"`
+	Status        string   `json:"status,omitempty"`
+	WarningEvents []string `json:"warningEvents,omitempty"`
+}
+
+// BenchmarkResult captures fio results for a single target, such as a filesystem or block volume
+type BenchmarkResult struct {
+	StorageClass  string          `json:"storageClass"`
+	Target        string          `json:"target"`
+	RandRead      BenchmarkMetric `json:"randRead"`
+	RandWrite     BenchmarkMetric `json:"randWrite"`
+	SeqReadMiBps  float64         `json:"seqReadMiBps"`
+	SeqWriteMiBps float64         `json:"seqWriteMiBps"`
+	Violations    []string        `json:"violations,omitempty"`
+}
+
+// BenchmarkMetric captures iops and completion latency percentiles of a random io job
+type BenchmarkMetric struct {
+	IOPS         float64 `json:"iops"`
+	LatencyP50Ms float64 `json:"latencyP50Ms"`
+	LatencyP90Ms float64 `json:"latencyP90Ms"`
+	LatencyP99Ms float64 `json:"latencyP99Ms"`
+}
+
+// MigrationResult captures a single live migration of the validation vm between two nodes
+type MigrationResult struct {
+	SourceNode      string      `json:"sourceNode"`
+	TargetNode      string      `json:"targetNode"`
+	Status          CheckStatus `json:"status"`
+	DurationSeconds float64     `json:"durationSeconds,omitempty"`
+	Info            string      `json:"info,omitempty"`
+}
+
+// MigrationIOResult captures the guest io observed while the validation vm was live migrated
+type MigrationIOResult struct {
+	DurationSeconds float64        `json:"durationSeconds"`
+	Disks           []DiskIOResult `json:"disks"`
+}
+
+// DiskIOResult captures the writes issued to a disk during a live migration
+type DiskIOResult struct {
+	Disk       string  `json:"disk"`
+	Writes     int     `json:"writes"`
+	LostWrites int     `json:"lostWrites"`
+	MaxStallMs float64 `json:"maxStallMs"`
+}
+
+// HotplugScaleResult captures how many volumes could be hot plugged to the validation vm,
+// and which component limited the number of volumes when the configured maximum was not reached
+type HotplugScaleResult struct {
+	MaxAttached int                   `json:"maxAttached"`
+	LimitSource string                `json:"limitSource,omitempty"`
+	LimitInfo   string                `json:"limitInfo,omitempty"`
+	Volumes     []HotplugAttachResult `json:"volumes"`
+}
+
+// HotplugAttachResult captures the time taken for a hot plugged volume to attach
+type HotplugAttachResult struct {
+	Name          string  `json:"name"`
+	AttachSeconds float64 `json:"attachSeconds"`
+}
+
+const (
+	HotplugLimitKubeVirt  = "kubevirt"
+	HotplugLimitCSIDriver = "csi-driver"
+	HotplugLimitNode      = "node"
+)
+
+// StorageAuditResult captures the settings of the StorageClass and its CSIDriver, along with
+// findings explaining which checks are expected to fail or behave differently due to them
+type StorageAuditResult struct {
+	StorageClass    string            `json:"storageClass"`
+	Provisioner     string            `json:"provisioner"`
+	Settings        map[string]string `json:"settings"`
+	SnapshotClasses []string          `json:"snapshotClasses,omitempty"`
+	Findings        []string          `json:"findings,omitempty"`
+}
+
+// VolumeProbeResult captures the filesystem of a volume mounted by a probe pod, once data
+// written to it was read back intact
+type VolumeProbeResult struct {
+	PVC            string `json:"pvc"`
+	Node           string `json:"node"`
+	FilesystemType string `json:"filesystemType"`
+	MountOptions   string `json:"mountOptions"`
+	CapacityBytes  int64  `json:"capacityBytes"`
+	AvailableBytes int64  `json:"availableBytes"`
+}
+
+// NodeProbeResult captures whether a volume could be mounted, written and read back on a node
+type NodeProbeResult struct {
+	Node            string      `json:"node"`
+	Status          CheckStatus `json:"status"`
+	DurationSeconds float64     `json:"durationSeconds,omitempty"`
+	Info            string      `json:"info,omitempty"`
+}
+
+// FailoverResult captures the recovery of the validation vm after its virt-launcher pod was force deleted
+type FailoverResult struct {
+	SourceNode        string   `json:"sourceNode"`
+	TargetNode        string   `json:"targetNode,omitempty"`
+	RecoverySeconds   float64  `json:"recoverySeconds,omitempty"`
+	MultiAttachErrors []string `json:"multiAttachErrors,omitempty"`
+	StaleAttachments  []string `json:"staleAttachments,omitempty"`
+}
+
+// VMScaleResult captures the provisioning of vms booted in parallel from the same vmimage
+type VMScaleResult struct {
+	VMCount            int           `json:"vmCount"`
+	Succeeded          int           `json:"succeeded"`
+	Failed             int           `json:"failed"`
+	ThrottledRequests  int           `json:"throttledRequests"`
+	VolumeReadySeconds DurationStats `json:"volumeReadySeconds"`
+	RunningSeconds     DurationStats `json:"runningSeconds"`
+	Failures           []string      `json:"failures,omitempty"`
+}
+
+// DurationStats summarises the distribution of durations in seconds
+type DurationStats struct {
+	Min float64 `json:"min"`
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	Max float64 `json:"max"`
+}
+
+// SoakResult aggregates the results of the operations repeated by the soak check
+type SoakResult struct {
+	Iterations       int                           `json:"iterations"`
+	DurationSeconds  float64                       `json:"durationSeconds"`
+	Operations       map[string]SoakOperationStats `json:"operations"`
+	Leaks            []string                      `json:"leaks,omitempty"`
+	IterationResults []SoakIteration               `json:"iterationResults"`
+}
+
+// SoakOperationStats counts the outcomes of an operation across iterations
+type SoakOperationStats struct {
+	Succeeded int           `json:"succeeded"`
+	Failed    int           `json:"failed"`
+	Seconds   DurationStats `json:"seconds"`
+}
+
+// SoakIteration captures the operations of a single iteration, and the number of
+// storage resources present in the cluster once the iteration completed
+type SoakIteration struct {
+	Iteration  int                   `json:"iteration"`
+	Operations []SoakOperationResult `json:"operations"`
+	Resources  map[string]int        `json:"resources"`
+}
+
+type SoakOperationResult struct {
+	Name            string      `json:"name"`
+	Status          CheckStatus `json:"status"`
+	DurationSeconds float64     `json:"durationSeconds"`
+	Info            string      `json:"info,omitempty"`
 }
 
 type EnvironmentInfo struct {
-	HarvesterVersion string `json:"harvesterVersion"`
-	NodeCount        int    `json:"nodeCount"`
-	ValidatorVersion string `json:"validatorVersion"`
+	HarvesterVersion  string        `json:"harvesterVersion"`
+	NodeCount         int           `json:"nodeCount"`
+	ValidatorVersion  string        `json:"validatorVersion"`
+	KubernetesVersion string        `json:"kubernetesVersion"`
+	KubeVirtVersion   string        `json:"kubevirtVersion"`
+	CDIVersion        string        `json:"cdiVersion"`
+	LonghornVersion   string        `json:"longhornVersion"`
+	CSIDriver         CSIDriverInfo `json:"csiDriver"`
+	Nodes             []NodeInfo    `json:"nodes,omitempty"`
+}
+
+// CSIDriverInfo identifies the csi driver of the storage class, and the images of its node plugin and controller pods
+type CSIDriverInfo struct {
+	Name   string   `json:"name"`
+	Images []string `json:"images,omitempty"`
+}
+
+// NodeInfo captures the operating system and runtime of a node, along with the csi drivers
+// registered on it
+type NodeInfo struct {
+	Name             string          `json:"name"`
+	OSImage          string          `json:"osImage"`
+	KernelVersion    string          `json:"kernelVersion"`
+	ContainerRuntime string          `json:"containerRuntime"`
+	Architecture     string          `json:"architecture"`
+	CSIDrivers       []CSINodeDriver `json:"csiDrivers,omitempty"`
+}
+
+// CSINodeDriver is a csi driver registered with the kubelet of a node, as listed in its CSINode
+type CSINodeDriver struct {
+	Name             string `json:"name"`
+	NodeID           string `json:"nodeID"`
+	AllocatableCount *int32 `json:"allocatableCount,omitempty"`
 }
 
 type CheckStatus string
@@ -24,6 +226,9 @@ const CheckStatusSuccess CheckStatus = "success"
 const CheckStatusFailure CheckStatus = "failure"
 const CheckStatusSkipped CheckStatus = "skipped"
 
+// CheckStatusNotApplicable marks checks which depend on a feature the storage class does not support
+const CheckStatusNotApplicable CheckStatus = "not-applicable"
+
 func (r *Result) AddFailureInfo(err error) {
 	r.Status = CheckStatusFailure
 	r.Info = err.Error()
@@ -0,0 +1,145 @@
+package validation
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	snapshot "github.com/kubernetes-csi/external-snapshotter/client/v4/apis/volumesnapshot/v1"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/harvester/storage-validator/pkg/api"
+)
+
+// fsTypeParameters are the storage class parameters used by csi drivers to select the filesystem
+var fsTypeParameters = []string{"csi.storage.k8s.io/fstype", "fsType"}
+
+// auditStorageClass inspects the storage class and its csi driver without creating any objects,
+// and reports settings which cause later checks to fail or behave differently. the audit
+// itself does not fail, as the findings are explained ahead of the checks affected by them
+func (v *ValidationRun) auditStorageClass(ctx context.Context) error {
+	var driver *storagev1.CSIDriver
+	driverObj := &storagev1.CSIDriver{}
+	err := v.clients.runtimeClient.Get(ctx, types.NamespacedName{Name: v.storageClass.Provisioner}, driverObj)
+	switch {
+	case err == nil:
+		driver = driverObj
+	case !apierrors.IsNotFound(err):
+		return fmt.Errorf("error looking up csidriver %s: %w", v.storageClass.Provisioner, err)
+	}
+
+	// clusters without the external snapshotter do not serve the volumesnapshotclass api,
+	// which is reported as a finding rather than failing the audit
+	snapshotAPI := true
+	snapshotClassList := &snapshot.VolumeSnapshotClassList{}
+	if err := v.clients.runtimeClient.List(ctx, snapshotClassList); err != nil {
+		if !meta.IsNoMatchError(err) {
+			return fmt.Errorf("error listing volumesnapshotclasses: %w", err)
+		}
+		snapshotAPI = false
+	}
+
+	result := auditStorage(v.storageClass, driver, snapshotAPI, snapshotClassList.Items, v.Configuration.SnapshotClass)
+	v.Report.StorageAudit = result
+	for _, finding := range result.Findings {
+		logrus.Warnf("storage audit: %s", finding)
+	}
+	return nil
+}
+
+// auditStorage collects the settings of the storage class and csi driver, and explains
+// the impact of settings affecting subsequent checks
+func auditStorage(sc *storagev1.StorageClass, driver *storagev1.CSIDriver, snapshotAPI bool, snapshotClasses []snapshot.VolumeSnapshotClass, configuredSnapshotClass string) *api.StorageAuditResult {
+	result := &api.StorageAuditResult{
+		StorageClass: sc.Name,
+		Provisioner:  sc.Provisioner,
+		Settings:     map[string]string{},
+	}
+	finding := func(format string, args ...any) {
+		result.Findings = append(result.Findings, fmt.Sprintf(format, args...))
+	}
+
+	allowExpansion := sc.AllowVolumeExpansion != nil && *sc.AllowVolumeExpansion
+	result.Settings["allowVolumeExpansion"] = strconv.FormatBool(allowExpansion)
+	if !allowExpansion {
+		finding("allowVolumeExpansion is not enabled, the offline volume expansion check is expected to fail")
+	}
+
+	bindingMode := storagev1.VolumeBindingImmediate
+	if sc.VolumeBindingMode != nil {
+		bindingMode = *sc.VolumeBindingMode
+	}
+	result.Settings["volumeBindingMode"] = string(bindingMode)
+	if bindingMode == storagev1.VolumeBindingWaitForFirstConsumer {
+		finding("volumeBindingMode is %s, volumes are only provisioned once a pod or vm uses them, which adds to the time taken by checks", bindingMode)
+	}
+
+	reclaimPolicy := corev1.PersistentVolumeReclaimDelete
+	if sc.ReclaimPolicy != nil {
+		reclaimPolicy = *sc.ReclaimPolicy
+	}
+	result.Settings["reclaimPolicy"] = string(reclaimPolicy)
+	if reclaimPolicy != corev1.PersistentVolumeReclaimDelete {
+		finding("reclaimPolicy is %s, persistent volumes are left behind once the validation objects are removed, and the soak check is expected to report them as leaks", reclaimPolicy)
+	}
+
+	for _, parameter := range fsTypeParameters {
+		if fsType, ok := sc.Parameters[parameter]; ok {
+			result.Settings["fsType"] = fsType
+		}
+	}
+	if _, ok := result.Settings["fsType"]; !ok {
+		result.Settings["fsType"] = "driver default"
+	}
+
+	if driver == nil {
+		finding("no CSIDriver object found for provisioner %s, the csi node plugin restart check is expected to fail and hotplug attach limits cannot be attributed to the driver", sc.Provisioner)
+	} else {
+		attachRequired := driver.Spec.AttachRequired == nil || *driver.Spec.AttachRequired
+		result.Settings["attachRequired"] = strconv.FormatBool(attachRequired)
+		if !attachRequired {
+			finding("attachRequired is false, the driver does not use VolumeAttachments, so detach and stale attachment checks pass without verifying detach")
+		}
+
+		fsGroupPolicy := storagev1.ReadWriteOnceWithFSTypeFSGroupPolicy
+		if driver.Spec.FSGroupPolicy != nil {
+			fsGroupPolicy = *driver.Spec.FSGroupPolicy
+		}
+		result.Settings["fsGroupPolicy"] = string(fsGroupPolicy)
+		if fsGroupPolicy == storagev1.NoneFSGroupPolicy {
+			finding("fsGroupPolicy is %s, volume ownership is not changed for pods requesting an fsGroup", fsGroupPolicy)
+		}
+
+		podInfoOnMount := driver.Spec.PodInfoOnMount != nil && *driver.Spec.PodInfoOnMount
+		result.Settings["podInfoOnMount"] = strconv.FormatBool(podInfoOnMount)
+	}
+
+	var configuredFound bool
+	for _, class := range snapshotClasses {
+		if class.Driver != sc.Provisioner {
+			if class.Name == configuredSnapshotClass {
+				finding("volumesnapshotclass %s uses driver %s rather than %s, the snapshot checks are expected to fail", class.Name, class.Driver, sc.Provisioner)
+				configuredFound = true
+			}
+			continue
+		}
+		result.SnapshotClasses = append(result.SnapshotClasses, class.Name)
+		if class.Name == configuredSnapshotClass {
+			configuredFound = true
+		}
+	}
+	switch {
+	case !snapshotAPI:
+		finding("no volumesnapshotclass api is installed in the cluster, the snapshot checks are expected to fail")
+	case len(result.SnapshotClasses) == 0:
+		finding("no volumesnapshotclass found for driver %s, the snapshot checks are expected to fail", sc.Provisioner)
+	case configuredSnapshotClass != "" && !configuredFound:
+		finding("volumesnapshotclass %s not found, the snapshot checks are expected to fail", configuredSnapshotClass)
+	}
+	return result
+}
@@ -0,0 +1,50 @@
+package validation
+
+import (
+	"testing"
+
+	snapshot "github.com/kubernetes-csi/external-snapshotter/client/v4/apis/volumesnapshot/v1"
+	"github.com/stretchr/testify/require"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+func Test_AuditStorage(t *testing.T) {
+	assert := require.New(t)
+	sc := &storagev1.StorageClass{
+		ObjectMeta:           metav1.ObjectMeta{Name: "harvester-longhorn"},
+		Provisioner:          "driver.longhorn.io",
+		AllowVolumeExpansion: ptr.To(true),
+		Parameters:           map[string]string{"fsType": "ext4"},
+	}
+	driver := &storagev1.CSIDriver{
+		ObjectMeta: metav1.ObjectMeta{Name: "driver.longhorn.io"},
+	}
+	snapshotClasses := []snapshot.VolumeSnapshotClass{
+		{ObjectMeta: metav1.ObjectMeta{Name: "longhorn-snapshot"}, Driver: "driver.longhorn.io"},
+		{ObjectMeta: metav1.ObjectMeta{Name: "ceph-snapshot"}, Driver: "rbd.csi.ceph.com"},
+	}
+
+	result := auditStorage(sc, driver, true, snapshotClasses, "longhorn-snapshot")
+	assert.Empty(result.Findings)
+	assert.Equal([]string{"longhorn-snapshot"}, result.SnapshotClasses)
+	assert.Equal("ext4", result.Settings["fsType"])
+	assert.Equal("true", result.Settings["attachRequired"])
+	assert.Equal(string(storagev1.VolumeBindingImmediate), result.Settings["volumeBindingMode"])
+
+	sc.AllowVolumeExpansion = nil
+	result = auditStorage(sc, nil, true, snapshotClasses, "ceph-snapshot")
+	assert.Len(result.Findings, 3)
+	assert.Contains(result.Findings[0], "offline volume expansion")
+	assert.Contains(result.Findings[1], "no CSIDriver")
+	assert.Contains(result.Findings[2], "ceph-snapshot uses driver rbd.csi.ceph.com")
+
+	result = auditStorage(sc, driver, true, nil, "")
+	assert.Len(result.Findings, 2)
+	assert.Contains(result.Findings[1], "no volumesnapshotclass found for driver driver.longhorn.io")
+
+	result = auditStorage(sc, driver, false, nil, "longhorn-snapshot")
+	assert.Len(result.Findings, 2)
+	assert.Contains(result.Findings[1], "no volumesnapshotclass api is installed")
+}
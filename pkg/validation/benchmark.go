@@ -0,0 +1,409 @@
+package validation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/harvester/storage-validator/pkg/api"
+)
+
+const (
+	BenchmarkTargetFilesystem = "filesystem"
+	BenchmarkTargetBlock      = "block"
+	BenchmarkTargetVM         = "vm"
+
+	benchmarkMountPath  = "/data"
+	benchmarkDevicePath = "/dev/benchmark"
+	benchmarkGuestFile  = "/var/tmp/storage-validation-fio"
+	// benchmarkFileRatio of the volume is used by the fio test file, leaving room for filesystem overhead
+	benchmarkFileRatio = 0.8
+	// fioRampSeconds is the time each fio job runs before its results are recorded
+	fioRampSeconds = 5
+	// benchmarkTargetAllowance covers provisioning the volume and starting fio for each target
+	benchmarkTargetAllowance = time.Minute
+)
+
+// fioJobs are run sequentially, random io jobs measure iops and latency
+// while sequential jobs measure throughput
+var fioJobs = []struct {
+	name      string
+	rw        string
+	blockSize string
+	ioDepth   int
+}{
+	{name: "randread", rw: "randread", blockSize: "4k", ioDepth: 64},
+	{name: "randwrite", rw: "randwrite", blockSize: "4k", ioDepth: 64},
+	{name: "seqread", rw: "read", blockSize: "1M", ioDepth: 16},
+	{name: "seqwrite", rw: "write", blockSize: "1M", ioDepth: 16},
+}
+
+// fioOutput is the subset of the fio json output used by the benchmark
+type fioOutput struct {
+	Jobs []struct {
+		JobName string   `json:"jobname"`
+		Read    fioStats `json:"read"`
+		Write   fioStats `json:"write"`
+	} `json:"jobs"`
+}
+
+type fioStats struct {
+	IOPS   float64 `json:"iops"`
+	BW     float64 `json:"bw"` // KiB/s
+	ClatNs struct {
+		Percentile map[string]float64 `json:"percentile"`
+	} `json:"clat_ns"`
+}
+
+// runBenchmark runs fio against a filesystem and a block volume from the storage class
+// under validation, and optionally inside the validation vm. results are added to the
+// report, and the check fails when the thresholds configured for the class are not met
+func (v *ValidationRun) runBenchmark(ctx context.Context) error {
+	if !v.Configuration.Benchmark.Enabled {
+		return skipCheck("benchmark not enabled, set benchmark.enabled to run fio against storage class %s", v.Configuration.StorageClass)
+	}
+	if v.Configuration.Benchmark.Image == "" {
+		return skipCheck("no benchmark.image specified, an image containing fio, pinned by digest, is needed to run the benchmark")
+	}
+
+	var errs []error
+	for _, target := range []string{BenchmarkTargetFilesystem, BenchmarkTargetBlock} {
+		output, err := v.runBenchmarkPod(ctx, target)
+		if err != nil {
+			return err
+		}
+		errs = append(errs, v.recordBenchmark(target, output))
+	}
+
+	if v.Configuration.Benchmark.InVM {
+		output, err := v.runBenchmarkInVM(ctx)
+		var skipErr *skippedError
+		switch {
+		case errors.As(err, &skipErr):
+			logrus.Warnf("skipping benchmark inside vm: %s", skipErr.reason)
+		case err != nil:
+			return err
+		default:
+			errs = append(errs, v.recordBenchmark(BenchmarkTargetVM, output))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// benchmarkTimeout returns the time added to the run timeout for the benchmark, which runs
+// every fio job against each target in turn, or none when the benchmark is not enabled
+func (v *ValidationRun) benchmarkTimeout() time.Duration {
+	benchmark := v.Configuration.Benchmark
+	if !benchmark.Enabled || benchmark.Image == "" {
+		return 0
+	}
+	targets := 2
+	if benchmark.InVM {
+		targets++
+	}
+	perTarget := time.Duration(len(fioJobs)*(benchmark.Runtime+fioRampSeconds))*time.Second + benchmarkTargetAllowance
+	return time.Duration(targets) * perTarget
+}
+
+func (v *ValidationRun) planBenchmark() []client.Object {
+	if !v.Configuration.Benchmark.Enabled || v.Configuration.Benchmark.Image == "" {
+		return nil
+	}
+
+	var objs []client.Object
+	for _, target := range []string{BenchmarkTargetFilesystem, BenchmarkTargetBlock} {
+		pvc := v.newBenchmarkPVC(target)
+		objs = append(objs, pvc, v.newBenchmarkPod(target, plannedName(pvc)))
+	}
+	return objs
+}
+
+// runBenchmarkPod runs fio in a pod against a new volume and returns the fio output
+func (v *ValidationRun) runBenchmarkPod(ctx context.Context, target string) ([]byte, error) {
+	pvc := v.newBenchmarkPVC(target)
+	if err := v.clients.runtimeClient.Create(ctx, pvc); err != nil {
+		return nil, fmt.Errorf("error creating %s benchmark pvc: %w", target, err)
+	}
+	v.createdObjects = append(v.createdObjects, pvc)
+
+	pod := v.newBenchmarkPod(target, pvc.Name)
+	if err := v.clients.runtimeClient.Create(ctx, pod); err != nil {
+		return nil, fmt.Errorf("error creating %s benchmark pod: %w", target, err)
+	}
+	v.createdObjects = append(v.createdObjects, pod)
+
+	if err := v.waitUntilObjectIsReady(ctx, pod, verifyPodSucceeded); err != nil {
+		return nil, err
+	}
+
+	logs, err := v.clients.kubevirtClient.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{}).Stream(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching logs of benchmark pod %s: %w", pod.Name, err)
+	}
+	defer logs.Close()
+	return io.ReadAll(logs)
+}
+
+// runBenchmarkInVM runs fio against a file on the boot disk of the validation vm. the file is
+// sized from the space available on the boot disk, when it is less than the benchmark size
+func (v *ValidationRun) runBenchmarkInVM(ctx context.Context) ([]byte, error) {
+	guest, err := v.openGuestSession(ctx, v.vmName)
+	if err != nil {
+		return nil, err
+	}
+	defer guest.close()
+
+	if _, err := guest.run(ctx, "command -v fio"); err != nil {
+		return nil, skipCheck("fio is not available in the guest of vm %s, which is needed to benchmark inside the vm", v.vmName)
+	}
+
+	size, err := v.benchmarkFileSize()
+	if err != nil {
+		return nil, err
+	}
+	dfOutput, err := guest.run(ctx, "df -Pk "+path.Dir(benchmarkGuestFile)+" | tail -n 1")
+	if err != nil {
+		return nil, fmt.Errorf("error checking free space in guest of vm %s: %w", v.vmName, err)
+	}
+	available, err := parseDFAvailable(dfOutput)
+	if err != nil {
+		return nil, err
+	}
+	if guestSize := int64(float64(available) * benchmarkFileRatio); guestSize < size {
+		if guestSize <= 0 {
+			return nil, skipCheck("no free space on %s in guest of vm %s to benchmark inside the vm", path.Dir(benchmarkGuestFile), v.vmName)
+		}
+		logrus.Warnf("benchmark file inside vm %s reduced to %d bytes, as %d bytes are available on %s", v.vmName, guestSize, available, path.Dir(benchmarkGuestFile))
+		size = guestSize
+	}
+	command := "fio " + strings.Join(fioArgs(benchmarkGuestFile, size, v.Configuration.Benchmark.Runtime), " ") + "; rm -f " + benchmarkGuestFile
+	output, err := guest.run(ctx, command)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(output), nil
+}
+
+// recordBenchmark parses the fio output for the target, adds it to the report
+// and returns an error listing any thresholds which were not met
+func (v *ValidationRun) recordBenchmark(target string, output []byte) error {
+	result, err := parseFioOutput(output)
+	if err != nil {
+		return fmt.Errorf("error parsing %s benchmark output: %w", target, err)
+	}
+	result.StorageClass = v.Configuration.StorageClass
+	result.Target = target
+	result.Violations = evaluateBenchmark(result, v.Configuration.Benchmark.Thresholds[v.Configuration.StorageClass])
+	v.Report.Benchmarks = append(v.Report.Benchmarks, result)
+
+	if len(result.Violations) > 0 {
+		return fmt.Errorf("%s benchmark of storage class %s did not meet thresholds: %s", target, result.StorageClass, strings.Join(result.Violations, ", "))
+	}
+	return nil
+}
+
+// parseFioOutput extracts the metrics of the fio jobs from the json output,
+// ignoring any warnings printed by fio before the json document
+func parseFioOutput(output []byte) (api.BenchmarkResult, error) {
+	idx := strings.Index(string(output), "{")
+	if idx < 0 {
+		return api.BenchmarkResult{}, fmt.Errorf("no json found in fio output: %s", strings.TrimSpace(string(output)))
+	}
+
+	fio := fioOutput{}
+	if err := json.NewDecoder(strings.NewReader(string(output[idx:]))).Decode(&fio); err != nil {
+		return api.BenchmarkResult{}, err
+	}
+
+	result := api.BenchmarkResult{}
+	for _, job := range fio.Jobs {
+		switch job.JobName {
+		case "randread":
+			result.RandRead = newBenchmarkMetric(job.Read)
+		case "randwrite":
+			result.RandWrite = newBenchmarkMetric(job.Write)
+		case "seqread":
+			result.SeqReadMiBps = job.Read.BW / 1024
+		case "seqwrite":
+			result.SeqWriteMiBps = job.Write.BW / 1024
+		}
+	}
+	return result, nil
+}
+
+func newBenchmarkMetric(stats fioStats) api.BenchmarkMetric {
+	// fio reports percentiles with keys such as "99.000000" in nanoseconds
+	percentileMs := func(p float64) float64 {
+		return stats.ClatNs.Percentile[strconv.FormatFloat(p, 'f', 6, 64)] / 1e6
+	}
+	return api.BenchmarkMetric{
+		IOPS:         stats.IOPS,
+		LatencyP50Ms: percentileMs(50),
+		LatencyP90Ms: percentileMs(90),
+		LatencyP99Ms: percentileMs(99),
+	}
+}
+
+// evaluateBenchmark returns the thresholds which were not met by the result
+func evaluateBenchmark(result api.BenchmarkResult, thresholds api.BenchmarkThresholds) []string {
+	var violations []string
+	checkMin := func(name string, actual, minimum float64) {
+		if minimum > 0 && actual < minimum {
+			violations = append(violations, fmt.Sprintf("%s %.2f below minimum %.2f", name, actual, minimum))
+		}
+	}
+	checkMax := func(name string, actual, maximum float64) {
+		if maximum > 0 && actual > maximum {
+			violations = append(violations, fmt.Sprintf("%s %.2f above maximum %.2f", name, actual, maximum))
+		}
+	}
+
+	checkMin("random read iops", result.RandRead.IOPS, thresholds.MinRandReadIOPS)
+	checkMin("random write iops", result.RandWrite.IOPS, thresholds.MinRandWriteIOPS)
+	checkMin("sequential read MiB/s", result.SeqReadMiBps, thresholds.MinSeqReadMiBps)
+	checkMin("sequential write MiB/s", result.SeqWriteMiBps, thresholds.MinSeqWriteMiBps)
+	checkMax("random read p99 latency ms", result.RandRead.LatencyP99Ms, thresholds.MaxRandReadLatencyP99Ms)
+	checkMax("random write p99 latency ms", result.RandWrite.LatencyP99Ms, thresholds.MaxRandWriteLatencyP99Ms)
+	return violations
+}
+
+// fioArgs returns the fio arguments to run all benchmark jobs against the file or device
+func fioArgs(fileName string, size int64, runtime int) []string {
+	args := []string{
+		"--output-format=json",
+		"--ioengine=libaio",
+		"--direct=1",
+		"--time_based",
+		fmt.Sprintf("--runtime=%d", runtime),
+		fmt.Sprintf("--ramp_time=%d", fioRampSeconds),
+		"--filename=" + fileName,
+		fmt.Sprintf("--size=%d", size),
+	}
+	for _, job := range fioJobs {
+		args = append(args,
+			"--name="+job.name,
+			"--stonewall",
+			"--rw="+job.rw,
+			"--bs="+job.blockSize,
+			fmt.Sprintf("--iodepth=%d", job.ioDepth),
+		)
+	}
+	return args
+}
+
+// parseDFAvailable returns the bytes available from the last line of df -Pk output
+func parseDFAvailable(output string) (int64, error) {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	fields := strings.Fields(lines[len(lines)-1])
+	if len(fields) < 4 {
+		return 0, fmt.Errorf("unexpected df output: %q", output)
+	}
+	availableKB, err := strconv.ParseInt(fields[3], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected df output: %q", output)
+	}
+	return availableKB * 1024, nil
+}
+
+func (v *ValidationRun) benchmarkFileSize() (int64, error) {
+	size, err := resource.ParseQuantity(v.Configuration.Benchmark.Size)
+	if err != nil {
+		return 0, fmt.Errorf("error parsing benchmark size %s: %w", v.Configuration.Benchmark.Size, err)
+	}
+	return int64(float64(size.Value()) * benchmarkFileRatio), nil
+}
+
+// newBenchmarkPVC defines a volume of the storage class under validation for the target
+func (v *ValidationRun) newBenchmarkPVC(target string) *corev1.PersistentVolumeClaim {
+	volumeMode := corev1.PersistentVolumeFilesystem
+	if target == BenchmarkTargetBlock {
+		volumeMode = corev1.PersistentVolumeBlock
+	}
+	return &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: fmt.Sprintf("benchmark-%s-storage-validation-", target),
+			Namespace:    v.Configuration.Namespace,
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			StorageClassName: ptr.To(v.Configuration.StorageClass),
+			VolumeMode:       ptr.To(volumeMode),
+			Resources: corev1.VolumeResourceRequirements{
+				Requests: map[corev1.ResourceName]resource.Quantity{
+					corev1.ResourceStorage: resource.MustParse(v.Configuration.Benchmark.Size),
+				},
+			},
+		},
+	}
+}
+
+// newBenchmarkPod defines a pod running fio once against the filesystem or block pvc
+func (v *ValidationRun) newBenchmarkPod(target, pvcName string) *corev1.Pod {
+	size, _ := v.benchmarkFileSize()
+	container := corev1.Container{
+		Name:      "fio",
+		Image:     v.Configuration.Benchmark.Image,
+		Command:   []string{"fio"},
+		Resources: v.Configuration.Workload.Resources,
+	}
+
+	if target == BenchmarkTargetBlock {
+		container.Args = fioArgs(benchmarkDevicePath, size, v.Configuration.Benchmark.Runtime)
+		container.VolumeDevices = []corev1.VolumeDevice{{Name: "benchmark", DevicePath: benchmarkDevicePath}}
+	} else {
+		container.Args = fioArgs(benchmarkMountPath+"/fio", size, v.Configuration.Benchmark.Runtime)
+		container.VolumeMounts = []corev1.VolumeMount{{Name: "benchmark", MountPath: benchmarkMountPath}}
+	}
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: fmt.Sprintf("benchmark-%s-storage-validation-", target),
+			Namespace:    v.Configuration.Namespace,
+		},
+		Spec: corev1.PodSpec{
+			RestartPolicy: corev1.RestartPolicyNever,
+			Containers:    []corev1.Container{container},
+			Volumes: []corev1.Volume{
+				{
+					Name: "benchmark",
+					VolumeSource: corev1.VolumeSource{
+						PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+							ClaimName: pvcName,
+						},
+					},
+				},
+			},
+		},
+	}
+	v.applyWorkloadScheduling(&pod.Spec)
+	return pod
+}
+
+// verifyPodSucceeded waits for a pod running to completion, and fails if the pod fails
+func verifyPodSucceeded(obj client.Object) (bool, error) {
+	podObj, ok := obj.(*corev1.Pod)
+	if !ok {
+		return false, fmt.Errorf("error asserting object %v to pod", client.ObjectKeyFromObject(obj))
+	}
+	switch podObj.Status.Phase {
+	case corev1.PodSucceeded:
+		return true, nil
+	case corev1.PodFailed:
+		return false, fmt.Errorf("pod %s failed: %s", podObj.Name, describeObjectStatus(podObj))
+	}
+	return false, nil
+}
@@ -0,0 +1,65 @@
+package validation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/harvester/storage-validator/pkg/api"
+)
+
+const sampleFioOutput = `fio: some warning printed before the json output
+{
+  "jobs": [
+    {"jobname": "randread", "read": {"iops": 8000.5, "bw": 32002, "clat_ns": {"percentile": {"50.000000": 7000000, "90.000000": 9000000, "99.000000": 14000000}}}, "write": {"iops": 0, "bw": 0}},
+    {"jobname": "randwrite", "read": {"iops": 0, "bw": 0}, "write": {"iops": 3000, "bw": 12000, "clat_ns": {"percentile": {"50.000000": 20000000, "90.000000": 25000000, "99.000000": 41000000}}}},
+    {"jobname": "seqread", "read": {"iops": 400, "bw": 409600}, "write": {"iops": 0, "bw": 0}},
+    {"jobname": "seqwrite", "read": {"iops": 0, "bw": 0}, "write": {"iops": 180, "bw": 184320}}
+  ]
+}`
+
+func Test_ParseFioOutput(t *testing.T) {
+	assert := require.New(t)
+	result, err := parseFioOutput([]byte(sampleFioOutput))
+	assert.NoError(err)
+	assert.Equal(8000.5, result.RandRead.IOPS)
+	assert.Equal(14.0, result.RandRead.LatencyP99Ms)
+	assert.Equal(3000.0, result.RandWrite.IOPS)
+	assert.Equal(20.0, result.RandWrite.LatencyP50Ms)
+	assert.Equal(400.0, result.SeqReadMiBps)
+	assert.Equal(180.0, result.SeqWriteMiBps)
+
+	violations := evaluateBenchmark(result, api.BenchmarkThresholds{
+		MinRandReadIOPS:          5000,
+		MinSeqWriteMiBps:         200,
+		MaxRandWriteLatencyP99Ms: 40,
+	})
+	assert.Len(violations, 2)
+
+	_, err = parseFioOutput([]byte("fio: failed to open device"))
+	assert.Error(err)
+}
+
+func Test_BenchmarkTimeout(t *testing.T) {
+	assert := require.New(t)
+	v := &ValidationRun{Configuration: &api.Configuration{}}
+	assert.Zero(v.benchmarkTimeout())
+
+	v.Configuration.Benchmark = api.BenchmarkSpec{Enabled: true, Image: "fio@sha256:abcd", Runtime: 30}
+	// 4 jobs of 35 seconds each, and a minute to start each of the 2 targets
+	assert.Equal(2*(140*time.Second+time.Minute), v.benchmarkTimeout())
+
+	v.Configuration.Benchmark.InVM = true
+	assert.Equal(3*(140*time.Second+time.Minute), v.benchmarkTimeout())
+}
+
+func Test_ParseDFAvailable(t *testing.T) {
+	assert := require.New(t)
+	available, err := parseDFAvailable("/dev/vda3      9950188 2380112   7058616      26% /\n")
+	assert.NoError(err)
+	assert.Equal(int64(7058616*1024), available)
+
+	_, err = parseDFAvailable("df: /var/tmp: No such file or directory")
+	assert.Error(err)
+}
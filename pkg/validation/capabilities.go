@@ -0,0 +1,138 @@
+package validation
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	snapshot "github.com/kubernetes-csi/external-snapshotter/client/v4/apis/volumesnapshot/v1"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	cdiv1 "kubevirt.io/containerized-data-importer-api/pkg/apis/core/v1beta1"
+
+	"github.com/harvester/storage-validator/pkg/api"
+)
+
+// supportedFeatures lists the features which can be declared as unsupported in the configuration
+var supportedFeatures = []string{api.FeatureSnapshot, api.FeatureVolumeExpansion, api.FeatureRWX}
+
+// detectCapabilities identifies the features the storage class does not support, either as
+// declared in the configuration or detected from the cluster. checks requiring a missing
+// feature are reported as not-applicable, rather than failing and aborting the run
+func (v *ValidationRun) detectCapabilities() error {
+	if v.storageClass == nil {
+		return fmt.Errorf("no storageclass specified and no default storageclass found")
+	}
+
+	v.unsupported = map[string]string{}
+	for _, feature := range v.Configuration.UnsupportedFeatures {
+		if !slices.Contains(supportedFeatures, feature) {
+			return fmt.Errorf("unknown unsupported feature %s, supported values are %s", feature, strings.Join(supportedFeatures, ", "))
+		}
+		v.unsupported[feature] = "declared as unsupported in the configuration"
+	}
+
+	if _, ok := v.unsupported[api.FeatureSnapshot]; !ok {
+		reason, err := v.detectSnapshotSupport()
+		if err != nil {
+			return err
+		}
+		if reason != "" {
+			v.unsupported[api.FeatureSnapshot] = reason
+		}
+	}
+
+	if _, ok := v.unsupported[api.FeatureVolumeExpansion]; !ok {
+		if v.storageClass.AllowVolumeExpansion == nil || !*v.storageClass.AllowVolumeExpansion {
+			v.unsupported[api.FeatureVolumeExpansion] = fmt.Sprintf("storageclass %s does not allow volume expansion", v.storageClass.Name)
+		}
+	}
+
+	if _, ok := v.unsupported[api.FeatureRWX]; !ok {
+		profile, err := v.storageProfile()
+		if err != nil {
+			return err
+		}
+		if profile != nil && !profileSupportsRWX(profile) {
+			v.unsupported[api.FeatureRWX] = fmt.Sprintf("storageprofile %s does not list ReadWriteMany access mode", profile.Name)
+		}
+	}
+
+	v.Report.Capabilities = map[string]bool{}
+	for _, feature := range supportedFeatures {
+		reason, unsupported := v.unsupported[feature]
+		v.Report.Capabilities[feature] = !unsupported
+		if unsupported {
+			logrus.Warnf("%s not supported, dependent checks are not applicable: %s", feature, reason)
+		}
+	}
+	return nil
+}
+
+// detectSnapshotSupport returns why snapshots are not supported, or an empty string if they are
+func (v *ValidationRun) detectSnapshotSupport() (string, error) {
+	if v.Configuration.SnapshotClass == "" {
+		return fmt.Sprintf("no snapshot class specified or found for storageclass %s", v.storageClass.Name), nil
+	}
+
+	snapshotClassList := &snapshot.VolumeSnapshotClassList{}
+	if err := v.clients.runtimeClient.List(v.ctx, snapshotClassList); err != nil {
+		return "", fmt.Errorf("error listing volumesnapshotclasses: %w", err)
+	}
+	for _, class := range snapshotClassList.Items {
+		if class.Name == v.Configuration.SnapshotClass {
+			return "", nil
+		}
+	}
+	return fmt.Sprintf("volumesnapshotclass %s not found", v.Configuration.SnapshotClass), nil
+}
+
+// storageProfile returns the cdi storage profile of the storage class, or nil if there is none
+func (v *ValidationRun) storageProfile() (*cdiv1.StorageProfile, error) {
+	storageProfileList := &cdiv1.StorageProfileList{}
+	if err := v.clients.runtimeClient.List(v.ctx, storageProfileList); err != nil {
+		return nil, fmt.Errorf("error listing cdi storageprofiles: %w", err)
+	}
+	for i, profile := range storageProfileList.Items {
+		if profile.Status.StorageClass != nil && *profile.Status.StorageClass == v.Configuration.StorageClass {
+			return &storageProfileList.Items[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// profileSupportsRWX checks the claim property sets of the profile for ReadWriteMany. a profile
+// without claim property sets is not known to cdi, so rwx support is assumed
+func profileSupportsRWX(profile *cdiv1.StorageProfile) bool {
+	if len(profile.Status.ClaimPropertySets) == 0 {
+		return true
+	}
+	for _, set := range profile.Status.ClaimPropertySets {
+		if slices.Contains(set.AccessModes, corev1.ReadWriteMany) {
+			return true
+		}
+	}
+	return false
+}
+
+// notApplicable returns why a check requiring the features cannot be run, or an empty string
+func (v *ValidationRun) notApplicable(requires []string) string {
+	var reasons []string
+	for _, feature := range requires {
+		if reason, ok := v.unsupported[feature]; ok {
+			reasons = append(reasons, fmt.Sprintf("%s not supported: %s", feature, reason))
+		}
+	}
+	sort.Strings(reasons)
+	return strings.Join(reasons, ", ")
+}
+
+// volumeAccessMode returns the access mode requested by volumes created by the validator,
+// ReadWriteMany unless the storage class does not support it
+func (v *ValidationRun) volumeAccessMode() corev1.PersistentVolumeAccessMode {
+	if _, ok := v.unsupported[api.FeatureRWX]; ok {
+		return corev1.ReadWriteOnce
+	}
+	return corev1.ReadWriteMany
+}
@@ -0,0 +1,44 @@
+package validation
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	cdiv1 "kubevirt.io/containerized-data-importer-api/pkg/apis/core/v1beta1"
+
+	"github.com/harvester/storage-validator/pkg/api"
+)
+
+func Test_ProfileSupportsRWX(t *testing.T) {
+	assert := require.New(t)
+	profile := &cdiv1.StorageProfile{}
+	assert.True(profileSupportsRWX(profile))
+
+	profile.Status.ClaimPropertySets = []cdiv1.ClaimPropertySet{
+		{AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}},
+	}
+	assert.False(profileSupportsRWX(profile))
+
+	profile.Status.ClaimPropertySets = append(profile.Status.ClaimPropertySets, cdiv1.ClaimPropertySet{
+		AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteMany},
+	})
+	assert.True(profileSupportsRWX(profile))
+}
+
+func Test_NotApplicable(t *testing.T) {
+	assert := require.New(t)
+	v := &ValidationRun{}
+	assert.Empty(v.notApplicable([]string{api.FeatureSnapshot}))
+	assert.Equal(corev1.ReadWriteMany, v.volumeAccessMode())
+
+	v.unsupported = map[string]string{
+		api.FeatureSnapshot: "no snapshot class",
+		api.FeatureRWX:      "declared as unsupported in the configuration",
+	}
+	assert.Empty(v.notApplicable(nil))
+	assert.Empty(v.notApplicable([]string{api.FeatureVolumeExpansion}))
+	assert.Equal("rwx not supported: declared as unsupported in the configuration, snapshot not supported: no snapshot class",
+		v.notApplicable([]string{api.FeatureSnapshot, api.FeatureRWX}))
+	assert.Equal(corev1.ReadWriteOnce, v.volumeAccessMode())
+}
@@ -0,0 +1,187 @@
+package validation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// csiPluginWriterSeconds is how long the writer pod keeps writing to its volume,
+	// which covers the restart of the csi node plugin
+	csiPluginWriterSeconds = 180
+	csiPluginWriterName    = "csi-plugin-restart-storage-validation-"
+)
+
+// chaosTimeout returns the time added to the run timeout for the csi node plugin restart,
+// which covers the writer pod, or none when the restart is not enabled
+func (v *ValidationRun) chaosTimeout() time.Duration {
+	if !v.Configuration.Chaos.RestartCSINodePlugin {
+		return 0
+	}
+	return csiPluginWriterSeconds * time.Second
+}
+
+// restartCSINodePlugin restarts the csi node plugin pod of the storage class driver on the node
+// hosting the validation vm, while a pod and the guest are writing to volumes from the driver.
+// once the plugin is running again, the writes must have continued without errors and a new
+// volume must attach to the vm, as driver upgrades restart these pods under running workloads
+func (v *ValidationRun) restartCSINodePlugin(ctx context.Context) error {
+	if !v.Configuration.Chaos.RestartCSINodePlugin {
+		return skipCheck("csi node plugin restart not enabled, set chaos.restartCSINodePlugin to restart the plugin under load")
+	}
+
+	driver := &storagev1.CSIDriver{}
+	if err := v.clients.runtimeClient.Get(ctx, types.NamespacedName{Name: v.storageClass.Provisioner}, driver); err != nil {
+		return fmt.Errorf("error looking up csidriver %s: %w", v.storageClass.Provisioner, err)
+	}
+
+	nodeName, err := v.vmiNodeName(ctx)
+	if err != nil {
+		return err
+	}
+
+	plugin, err := v.findCSINodePluginPod(ctx, driver.Name, nodeName)
+	if err != nil {
+		return err
+	}
+
+	node := &corev1.Node{}
+	if err := v.clients.runtimeClient.Get(ctx, types.NamespacedName{Name: nodeName}, node); err != nil {
+		return fmt.Errorf("error looking up node %s: %w", nodeName, err)
+	}
+
+	pvc := v.newBaselinePVC(csiPluginWriterName)
+	if err := v.clients.runtimeClient.Create(ctx, pvc); err != nil {
+		return fmt.Errorf("error creating pvc: %w", err)
+	}
+	v.createdObjects = append(v.createdObjects, pvc)
+
+	pod := v.newCSIPluginWriterPod(nodeHostname(*node), pvc.Name)
+	if err := v.clients.runtimeClient.Create(ctx, pod); err != nil {
+		return fmt.Errorf("error creating pod: %w", err)
+	}
+	v.createdObjects = append(v.createdObjects, pod)
+	if err := v.waitUntilObjectIsReady(ctx, pod, verifyPodIsReady); err != nil {
+		return err
+	}
+
+	guest, err := v.openGuestSession(ctx, v.vmName)
+	if err != nil {
+		return err
+	}
+	targets := []ioMonitorTarget{{disk: "boot", path: ioMonitorBootFile}}
+	err = startIOWriters(ctx, guest, targets)
+	guest.close()
+	if err != nil {
+		return err
+	}
+
+	logrus.Infof("restarting csi node plugin pod %s/%s on node %s", plugin.Namespace, plugin.Name, nodeName)
+	if err := v.deleteAndWait(ctx, plugin); err != nil {
+		return err
+	}
+	restarted, err := v.findCSINodePluginPod(ctx, driver.Name, nodeName)
+	if err != nil {
+		return err
+	}
+	if err := v.waitUntilObjectIsReady(ctx, restarted, verifyPodIsReady); err != nil {
+		return fmt.Errorf("csi node plugin did not recover after restart: %w", err)
+	}
+
+	// a new attach exercises the restarted plugin, while the writers are still running
+	attachErr := v.hotplugAndUnplug(ctx, "csi-plugin-restart")
+
+	result, err := v.stopIOMonitor(ctx, targets)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	if attachErr != nil {
+		errs = append(errs, fmt.Errorf("volume failed to attach after csi node plugin restart: %w", attachErr))
+	}
+	for _, disk := range result.Disks {
+		if disk.LostWrites > 0 {
+			errs = append(errs, fmt.Errorf("%d of %d writes to vm %s disk were lost during csi node plugin restart", disk.LostWrites, disk.Writes, disk.Disk))
+		}
+	}
+	if err := v.waitUntilObjectIsReady(ctx, pod, verifyPodSucceeded); err != nil {
+		errs = append(errs, fmt.Errorf("writes to mounted volume failed during csi node plugin restart: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+func (v *ValidationRun) planRestartCSINodePlugin() []client.Object {
+	if !v.Configuration.Chaos.RestartCSINodePlugin {
+		return nil
+	}
+	pvc := v.newBaselinePVC(csiPluginWriterName)
+	return []client.Object{pvc, v.newCSIPluginWriterPod(plannedNodeName, plannedName(pvc)), v.newHotplugPVC(corev1.PersistentVolumeBlock)}
+}
+
+// findCSINodePluginPod finds the csi node plugin pod of the driver running on the node. the plugin
+// is identified by the registration socket of the driver, which node-driver-registrar registers
+// with the kubelet from a path under the plugins directory named after the driver
+func (v *ValidationRun) findCSINodePluginPod(ctx context.Context, driverName, nodeName string) (*corev1.Pod, error) {
+	backoff := newWaitBackoff()
+	for {
+		podList := &corev1.PodList{}
+		if err := v.clients.runtimeClient.List(ctx, podList, client.MatchingFields{"spec.nodeName": nodeName}); err != nil {
+			return nil, fmt.Errorf("error listing pods on node %s: %w", nodeName, err)
+		}
+
+		for i := range podList.Items {
+			pod := &podList.Items[i]
+			if pod.DeletionTimestamp == nil && isCSINodePlugin(pod, driverName) {
+				return pod, nil
+			}
+		}
+
+		// the plugin pod is recreated by its daemonset shortly after it is deleted
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("no csi node plugin pod found for driver %s on node %s", driverName, nodeName)
+		case <-time.After(backoff.Step()):
+		}
+	}
+}
+
+// isCSINodePlugin identifies the pod registering the driver with the kubelet
+func isCSINodePlugin(pod *corev1.Pod, driverName string) bool {
+	registrationPath := fmt.Sprintf("/plugins/%s/", driverName)
+	for _, container := range pod.Spec.Containers {
+		values := append(append([]string{}, container.Command...), container.Args...)
+		for _, env := range container.Env {
+			values = append(values, env.Value)
+		}
+		for _, value := range values {
+			if strings.Contains(value, registrationPath) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// newCSIPluginWriterPod defines a pod on the node with the hostname, which writes to the mounted
+// pvc every second and fails on the first failed write. like the node probes, the pod is pinned
+// through a node selector so volumes binding on first consumer are provisioned for the node
+func (v *ValidationRun) newCSIPluginWriterPod(hostname, pvcName string) *corev1.Pod {
+	script := fmt.Sprintf(`end=$(( $(date +%%s) + %d )); while [ $(date +%%s) -lt $end ]; do date >> %s/writes && sync || exit 1; sleep 1; done`,
+		csiPluginWriterSeconds, probeMountPath)
+
+	pod := v.newProbePod(csiPluginWriterName, pvcName)
+	pod.Spec.RestartPolicy = corev1.RestartPolicyNever
+	pod.Spec.NodeSelector = map[string]string{corev1.LabelHostname: hostname}
+	pod.Spec.Containers[0].Command = []string{"sh", "-c", script}
+	return pod
+}
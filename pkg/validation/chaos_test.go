@@ -0,0 +1,37 @@
+package validation
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func Test_IsCSINodePlugin(t *testing.T) {
+	assert := require.New(t)
+	registrar := &corev1.Pod{
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name: "node-driver-registrar",
+					Args: []string{"--v=2", "--csi-address=/csi/csi.sock", "--kubelet-registration-path=/var/lib/kubelet/plugins/driver.longhorn.io/csi.sock"},
+				},
+			},
+		},
+	}
+	envRegistrar := &corev1.Pod{
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name: "registrar",
+					Env:  []corev1.EnvVar{{Name: "DRIVER_REG_SOCK_PATH", Value: "/var/lib/kubelet/plugins/rbd.csi.ceph.com/csi.sock"}},
+				},
+			},
+		},
+	}
+
+	assert.True(isCSINodePlugin(registrar, "driver.longhorn.io"))
+	assert.False(isCSINodePlugin(registrar, "rbd.csi.ceph.com"))
+	assert.True(isCSINodePlugin(envRegistrar, "rbd.csi.ceph.com"))
+	assert.False(isCSINodePlugin(&corev1.Pod{}, "driver.longhorn.io"))
+}
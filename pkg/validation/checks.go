@@ -2,22 +2,36 @@ package validation
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/harvester/storage-validator/pkg/api"
 )
 
 // Current validation requirements are
+// * audit the storage class and csi driver settings affecting subsequent checks
 // * create a volume
+// * create a volume on every node, and ensure it can be written and read back
 // * create a snapshot
 // * perform offline volume expansion
 // * create a vmimage using the storage class specified
-// * boot a vm using storage class
-// * hotplug 2 volumes to a vm
+// * boot a vm using storage class, and optionally many vms in parallel
+// * stop the vm, ensure its volumes detach, and restart it with data intact
+// * hotplug block and filesystem volumes to a vm over each bus, migrate and unplug them
+// * optionally hotplug volumes until the per vm attach limit is found
+// * write to rwx filesystem and block volumes from two nodes at once
 // * create vm snapshots
-// * perform live migration across nodes
+// * perform live migration across nodes, optionally through every node
+// * drain the node hosting the vm and ensure it live migrates
+// * force delete the virt-launcher pod and ensure the vm recovers with its volume reattached
+// * optionally restart the csi node plugin under io and ensure volumes keep working
+// * create vmimages by exporting a volume, uploading and cloning, and boot vms from them
+// * optionally soak the vm by repeating lifecycle operations, tracking leaked resources
+// * optionally benchmark the storage class with fio
 
 const (
 	baselinePVCLabelKey = "storage-validator-baseline-pvc"
@@ -26,73 +40,208 @@ const (
 type Validation struct {
 	Name              string
 	ExecuteValidation validationFunc
+	Plan              planFunc
+	// Requires lists the storage class features the check depends on, the check
+	// is reported as not-applicable when any of them is not supported
+	Requires []string
 }
 
 type validationFunc func(ctx context.Context) error
 
+// skippedError is returned by checks which cannot be run in the current environment,
+// and marks the check as skipped without aborting subsequent checks
+type skippedError struct {
+	reason string
+}
+
+func (s *skippedError) Error() string {
+	return s.reason
+}
+
+func skipCheck(format string, args ...any) error {
+	return &skippedError{reason: fmt.Sprintf(format, args...)}
+}
+
+// planFunc returns the objects a validation would create, used to render a dry run
+type planFunc func() []client.Object
+
 func (v *ValidationRun) runChecks() error {
-	ctx, cancel := context.WithTimeout(v.ctx, time.Duration(*v.Configuration.Timeout)*time.Second)
+	// long running checks add the time they need to the timeout of the run
+	timeout := time.Duration(*v.Configuration.Timeout)*time.Second +
+		v.soakTimeout() + v.rwxTimeout() + v.chaosTimeout() +
+		v.benchmarkTimeout() + v.scaleTimeout() + v.hotplugScaleTimeout()
+	ctx, cancel := context.WithTimeout(v.ctx, timeout)
 	defer cancel()
+	// cleanup waits for checks to return rather than for the timeout, to ensure failure
+	// diagnostics are collected before the objects involved are removed
+	checksCtx, checksDone := context.WithCancel(v.ctx)
+	defer checksDone()
 	cleanupComplete := make(chan bool)
 	go func() {
-		err := v.cleanupResources(ctx, cleanupComplete)
+		err := v.cleanupResources(ctx, checksCtx, cleanupComplete)
 		if err != nil {
 			logrus.Errorf("error during resource cleaup: %v", err)
 		}
 	}()
 
-	validations := []Validation{
+	var err error
+	// on error break execution and ensure cleanup is triggered
+	for _, check := range v.validations() {
+		initiateCheck(check.Name)
+		result := &api.Result{
+			Name: check.Name,
+		}
+		defer func() {
+			v.AddResult(*result)
+		}()
+		if reason := v.notApplicable(check.Requires); reason != "" {
+			result.Status = api.CheckStatusNotApplicable
+			result.Info = reason
+			logrus.Warnf("⏭️  not applicable: %s: %s", check.Name, reason)
+			continue
+		}
+		err := check.ExecuteValidation(ctx)
+		var skipErr *skippedError
+		if errors.As(err, &skipErr) {
+			result.Status = api.CheckStatusSkipped
+			result.Info = skipErr.reason
+			logrus.Warnf("⏭️  skipped: %s: %s", check.Name, skipErr.reason)
+			continue
+		}
+		if err != nil {
+			result.AddFailureInfo(err)
+			addDiagnostics(result, err)
+			logrus.Errorf("validation failure: %v", err)
+			break
+		}
+		result.Status = api.CheckStatusSuccess
+		completedCheck(check.Name)
+	}
+
+	cancel()
+	checksDone()
+	<-cleanupComplete
+	return err
+}
+
+// validations returns the ordered list of checks to be run
+func (v *ValidationRun) validations() []Validation {
+	return []Validation{
+		{
+			Name:              "audit storage class and csi driver settings",
+			ExecuteValidation: v.auditStorageClass,
+		},
 		{
 			Name:              "ensure volume is created and used successfully",
 			ExecuteValidation: v.createVolume,
+			Plan:              v.planCreateVolume,
+		},
+		{
+			Name:              "ensure volumes can be used on every node",
+			ExecuteValidation: v.runNodeMatrix,
+			Plan:              v.planRunNodeMatrix,
 		},
 		{
 			Name:              "ensure volume snapshot can be created successfully",
 			ExecuteValidation: v.createSnapshot,
+			Plan:              v.planCreateSnapshot,
+			Requires:          []string{api.FeatureSnapshot},
 		},
 		{
 			Name:              "ensure offline volume expansion is successful",
 			ExecuteValidation: v.volumeOfflineResize,
+			Plan:              v.planVolumeOfflineResize,
+			Requires:          []string{api.FeatureVolumeExpansion},
 		},
 		{
 			Name:              "ensure vm image creation is successful",
 			ExecuteValidation: v.createVMImage,
+			Plan:              v.planCreateVMImage,
+		},
+		{
+			Name:              "ensure imported vm image matches source image",
+			ExecuteValidation: v.verifyVMImage,
 		},
 		{
 			Name:              "ensure vm can boot from recently created vmimage",
 			ExecuteValidation: v.createVirtualMachine,
+			Plan:              v.planCreateVirtualMachine,
+		},
+		{
+			Name:              "ensure vms can boot in parallel from the vmimage",
+			ExecuteValidation: v.createVirtualMachinesInParallel,
+			Plan:              v.planCreateVirtualMachinesInParallel,
+		},
+		{
+			Name:              "ensure vm can be stopped and restarted with data intact",
+			ExecuteValidation: v.restartVM,
 		},
 		{
 			Name:              "trigger VM migration",
 			ExecuteValidation: v.runVMMigration,
+			Plan:              v.planRunVMMigration,
+			Requires:          []string{api.FeatureRWX},
+		},
+		{
+			Name:              "migrate VM across every schedulable node",
+			ExecuteValidation: v.runVMMigrationRoundRobin,
+			Plan:              v.planRunVMMigrationRoundRobin,
+			Requires:          []string{api.FeatureRWX},
+		},
+		{
+			Name:              "ensure vm live migrates when its node is drained",
+			ExecuteValidation: v.drainVMNode,
+			Requires:          []string{api.FeatureRWX},
 		},
 		{
-			Name:              "hotplug 2 volumes to existing VM",
+			Name:              "ensure vm recovers when its virt-launcher pod is force deleted",
+			ExecuteValidation: v.forceDeleteVMLauncher,
+		},
+		{
+			Name:              "ensure vm and volumes survive a csi node plugin restart",
+			ExecuteValidation: v.restartCSINodePlugin,
+			Plan:              v.planRestartCSINodePlugin,
+		},
+		{
+			Name:              "hotplug volumes to existing VM, migrate and unplug them",
 			ExecuteValidation: v.hotPlugVolume,
+			Plan:              v.planHotPlugVolume,
+		},
+		{
+			Name:              "hotplug volumes to existing VM until the attach limit",
+			ExecuteValidation: v.hotPlugVolumeScale,
+			Plan:              v.planHotPlugVolumeScale,
+		},
+		{
+			Name:              "ensure rwx volumes can be written from two nodes at once",
+			ExecuteValidation: v.runRWXMultiWriter,
+			Plan:              v.planRunRWXMultiWriter,
+			Requires:          []string{api.FeatureRWX},
+		},
+		{
+			Name:              "ensure vm image can be exported from a volume and booted",
+			ExecuteValidation: v.createVMImageFromVolume,
+			Plan:              v.planCreateVMImageFromVolume,
+		},
+		{
+			Name:              "ensure vm image can be uploaded and booted",
+			ExecuteValidation: v.createVMImageFromUpload,
+			Plan:              v.planCreateVMImageFromUpload,
+		},
+		{
+			Name:              "ensure vm image can be cloned and booted",
+			ExecuteValidation: v.createVMImageFromClone,
+			Plan:              v.planCreateVMImageFromClone,
+		},
+		{
+			Name:              "soak vm by repeating lifecycle operations",
+			ExecuteValidation: v.runSoak,
+			Plan:              v.planRunSoak,
+		},
+		{
+			Name:              "benchmark storage class performance with fio",
+			ExecuteValidation: v.runBenchmark,
+			Plan:              v.planBenchmark,
 		},
 	}
-
-	var err error
-	// on error break execution and ensure cleanup is triggered
-	for _, check := range validations {
-		initiateCheck(check.Name)
-		result := &api.Result{
-			Name: check.Name,
-		}
-		defer func() {
-			v.AddResult(*result)
-		}()
-		err := check.ExecuteValidation(ctx)
-		if err != nil {
-			result.AddFailureInfo(err)
-			logrus.Errorf("validation failure: %v", err)
-			break
-		}
-		result.Status = api.CheckStatusSuccess
-		completedCheck(check.Name)
-	}
-
-	cancel()
-	<-cleanupComplete
-	return err
 }
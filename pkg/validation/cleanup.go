@@ -10,9 +10,13 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
-func (v *ValidationRun) cleanupResources(ctx context.Context, complete chan bool) error {
+func (v *ValidationRun) cleanupResources(ctx context.Context, checksCtx context.Context, complete chan bool) error {
+	defer func() {
+		complete <- true
+	}()
+
 	// block execution until checks have completed or timed out
-	<-ctx.Done()
+	<-checksCtx.Done()
 	if ctx.Err() != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
 		logrus.Errorf("validation timed out")
 	}
@@ -36,7 +40,6 @@ func (v *ValidationRun) cleanupResources(ctx context.Context, complete chan bool
 		}
 
 	}
-	complete <- true
 	return nil
 }
 
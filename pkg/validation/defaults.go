@@ -1,5 +1,7 @@
 package validation
 
+import "time"
+
 const (
 	DefaultNamespace        = "default"
 	DefaultCPU              = 2
@@ -10,5 +12,13 @@ const (
 	DefaultPVCSize          = "1Gi"
 	DefaultPVCResizeRequest = "2Gi"
 	LonghornProvisioner     = "driver.longhorn.io"
+	DefaultProbeImage       = "registry.suse.com/suse/nginx:1.21"
+	DefaultBenchmarkSize    = "5Gi"
+	DefaultBenchmarkRuntime = 30 // duration in seconds of each fio job
+	DefaultGuestUser        = "root"
+	DefaultAttachTimeout    = 120 // duration in seconds to wait for a hot plugged volume to attach
+	redactedValue           = "<redacted>"
 	maxRetryCount           = 3
+	waitResyncInterval      = 15 * time.Second
+	diagnosticsTimeout      = 30 * time.Second
 )
@@ -0,0 +1,194 @@
+package validation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	harvesterv1beta1 "github.com/harvester/harvester/pkg/apis/harvesterhci.io/v1beta1"
+	snapshot "github.com/kubernetes-csi/external-snapshotter/client/v4/apis/volumesnapshot/v1"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	kubevirtv1 "kubevirt.io/api/core/v1"
+	cdiv1 "kubevirt.io/containerized-data-importer-api/pkg/apis/core/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/harvester/storage-validator/pkg/api"
+)
+
+const (
+	// importPodAnnotation is set by cdi on a pvc being populated by an importer pod
+	importPodAnnotation = "cdi.kubevirt.io/storage.import.importPodName"
+	// launcherPodVMILabel identifies the virt-launcher pods of a vmi by vmi uid
+	launcherPodVMILabel = "kubevirt.io/created-by"
+	// maxDiagnosticsDepth limits how far related objects are followed from the failed object
+	maxDiagnosticsDepth = 4
+	// maxEventsPerObject limits the number of warning events reported per object
+	maxEventsPerObject = 5
+)
+
+// waitError is returned when an object does not reach the desired state, and carries
+// the last observed state of the object and related objects to explain the failure
+type waitError struct {
+	err         error
+	diagnostics []api.ObjectDiagnostics
+}
+
+func (w *waitError) Error() string {
+	return w.err.Error()
+}
+
+func (w *waitError) Unwrap() error {
+	return w.err
+}
+
+// newWaitError wraps a failure waiting for the object with the diagnostics of the object and
+// related objects. diagnostics are collected with their own deadline, as the wait may have
+// failed because the context of the check expired
+func (v *ValidationRun) newWaitError(obj client.Object, err error) error {
+	diagCtx, cancel := newDiagnosticsContext()
+	defer cancel()
+	return &waitError{
+		err:         err,
+		diagnostics: v.collectDiagnostics(diagCtx, obj),
+	}
+}
+
+// addDiagnostics attaches diagnostics carried by a wait error to the result
+func addDiagnostics(result *api.Result, err error) {
+	var wErr *waitError
+	if errors.As(err, &wErr) {
+		result.Diagnostics = wErr.diagnostics
+	}
+}
+
+// collectDiagnostics reports the status and Warning events of an object and the objects
+// related to it, such as the pv of a pvc or the virt-launcher pod of a vm.
+// the last observed state of the object is used as is, while related objects are fetched
+func (v *ValidationRun) collectDiagnostics(ctx context.Context, obj client.Object) []api.ObjectDiagnostics {
+	var diagnostics []api.ObjectDiagnostics
+	visited := map[types.UID]bool{}
+
+	var collect func(obj client.Object, depth int)
+	collect = func(obj client.Object, depth int) {
+		if obj.GetUID() != "" {
+			if visited[obj.GetUID()] {
+				return
+			}
+			visited[obj.GetUID()] = true
+		}
+
+		diagnostics = append(diagnostics, v.objectDiagnostics(ctx, obj))
+		if depth >= maxDiagnosticsDepth || obj.GetUID() == "" {
+			return
+		}
+
+		for _, related := range v.relatedObjects(ctx, obj) {
+			collect(related, depth+1)
+		}
+	}
+
+	collect(obj, 1)
+	return diagnostics
+}
+
+func (v *ValidationRun) objectDiagnostics(ctx context.Context, obj client.Object) api.ObjectDiagnostics {
+	diag := api.ObjectDiagnostics{
+		Kind:   objectKind(obj),
+		Name:   client.ObjectKeyFromObject(obj).String(),
+		Status: describeObjectStatus(obj),
+	}
+	if obj.GetUID() == "" {
+		diag.Status = "not found"
+		return diag
+	}
+
+	events, err := v.warningEvents(ctx, obj)
+	if err != nil {
+		logrus.Debugf("%v", err)
+	}
+
+	seen := map[string]bool{}
+	for _, event := range events {
+		msg := fmt.Sprintf("%s: %s", event.Reason, event.Message)
+		if seen[msg] {
+			continue
+		}
+		seen[msg] = true
+		diag.WarningEvents = append(diag.WarningEvents, msg)
+		if len(diag.WarningEvents) == maxEventsPerObject {
+			break
+		}
+	}
+	return diag
+}
+
+// relatedObjects looks up objects which commonly explain why an object is not ready
+func (v *ValidationRun) relatedObjects(ctx context.Context, obj client.Object) []client.Object {
+	var related []client.Object
+	namespace := obj.GetNamespace()
+	switch o := obj.(type) {
+	case *corev1.PersistentVolumeClaim:
+		if o.Spec.VolumeName != "" {
+			related = append(related, v.fetchRelated(ctx, &corev1.PersistentVolume{}, "", o.Spec.VolumeName))
+		}
+		if podName, ok := o.Annotations[importPodAnnotation]; ok {
+			related = append(related, v.fetchRelated(ctx, &corev1.Pod{}, namespace, podName))
+		}
+	case *corev1.Pod:
+		for _, volume := range o.Spec.Volumes {
+			if volume.PersistentVolumeClaim != nil {
+				related = append(related, v.fetchRelated(ctx, &corev1.PersistentVolumeClaim{}, namespace, volume.PersistentVolumeClaim.ClaimName))
+			}
+		}
+	case *snapshot.VolumeSnapshot:
+		if o.Spec.Source.PersistentVolumeClaimName != nil {
+			related = append(related, v.fetchRelated(ctx, &corev1.PersistentVolumeClaim{}, namespace, *o.Spec.Source.PersistentVolumeClaimName))
+		}
+		if o.Status != nil && o.Status.BoundVolumeSnapshotContentName != nil {
+			related = append(related, v.fetchRelated(ctx, &snapshot.VolumeSnapshotContent{}, "", *o.Status.BoundVolumeSnapshotContentName))
+		}
+	case *cdiv1.DataVolume:
+		related = append(related, v.fetchRelated(ctx, &corev1.PersistentVolumeClaim{}, namespace, o.Name))
+	case *harvesterv1beta1.VirtualMachineImage:
+		// images using the cdi backend are populated into a golden datavolume with the same name
+		if o.Spec.Backend == harvesterv1beta1.VMIBackendCDI {
+			related = append(related, v.fetchRelated(ctx, &cdiv1.DataVolume{}, namespace, o.Name))
+		}
+	case *kubevirtv1.VirtualMachine:
+		related = append(related, v.fetchRelated(ctx, &kubevirtv1.VirtualMachineInstance{}, namespace, o.Name))
+	case *kubevirtv1.VirtualMachineInstance:
+		podList := &corev1.PodList{}
+		if err := v.clients.runtimeClient.List(ctx, podList, client.InNamespace(namespace), client.MatchingLabels{launcherPodVMILabel: string(o.UID)}); err != nil {
+			logrus.Debugf("error listing virt-launcher pods for vmi %s: %v", o.Name, err)
+		}
+		for i := range podList.Items {
+			related = append(related, &podList.Items[i])
+		}
+	case *kubevirtv1.VirtualMachineInstanceMigration:
+		related = append(related, v.fetchRelated(ctx, &kubevirtv1.VirtualMachineInstance{}, namespace, o.Spec.VMIName))
+		if o.Status.MigrationState != nil && o.Status.MigrationState.TargetPod != "" {
+			related = append(related, v.fetchRelated(ctx, &corev1.Pod{}, namespace, o.Status.MigrationState.TargetPod))
+		}
+	}
+	return related
+}
+
+// fetchRelated fetches a related object by name, objects which cannot be found
+// are still returned so the diagnostics report them as missing
+func (v *ValidationRun) fetchRelated(ctx context.Context, obj client.Object, namespace, name string) client.Object {
+	if err := v.clients.runtimeClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, obj); err != nil {
+		logrus.Debugf("error fetching related object %s/%s: %v", namespace, name, err)
+		obj.SetNamespace(namespace)
+		obj.SetName(name)
+		obj.SetUID("")
+	}
+	return obj
+}
+
+// newDiagnosticsContext returns a context used to collect diagnostics, which is
+// independent of the check context as the latter has usually expired by then
+func newDiagnosticsContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), diagnosticsTimeout)
+}
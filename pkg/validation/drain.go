@@ -0,0 +1,133 @@
+package validation
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	kubevirtv1 "kubevirt.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// uncordonTimeout bounds uncordoning the drained node, which runs after the check returns and
+// may no longer use the context of the run
+const uncordonTimeout = time.Minute
+
+// drainVMNode cordons the node hosting the validation vmi and evicts the virt-launcher pod,
+// which kubevirt turns into a live migration due to the LiveMigrate eviction strategy.
+// only pods of the validation vm are evicted, to avoid disrupting other workloads on the node
+func (v *ValidationRun) drainVMNode(ctx context.Context) error {
+	vmiObj := &kubevirtv1.VirtualMachineInstance{}
+	if err := v.clients.runtimeClient.Get(ctx, types.NamespacedName{Name: v.vmName, Namespace: v.Configuration.Namespace}, vmiObj); err != nil {
+		return fmt.Errorf("error looking up vmi %s: %w", v.vmName, err)
+	}
+	sourceNode := vmiObj.Status.NodeName
+
+	if err := v.setNodeUnschedulable(ctx, sourceNode, true); err != nil {
+		return err
+	}
+	// uncordon even when the check has timed out
+	defer func() {
+		uncordonCtx, cancel := context.WithTimeout(context.Background(), uncordonTimeout)
+		defer cancel()
+		if err := v.setNodeUnschedulable(uncordonCtx, sourceNode, false); err != nil {
+			logrus.Errorf("error uncordoning node %s: %v", sourceNode, err)
+		}
+	}()
+
+	if err := v.evictVMIPods(ctx, vmiObj, sourceNode); err != nil {
+		return err
+	}
+
+	verifyVMIDrained := func(obj client.Object) (bool, error) {
+		vmiObj, ok := obj.(*kubevirtv1.VirtualMachineInstance)
+		if !ok {
+			return false, fmt.Errorf("error asserting object %v to vmi", client.ObjectKeyFromObject(obj))
+		}
+
+		migration := vmiObj.Status.MigrationState
+		if migration != nil && migration.Failed {
+			return false, fmt.Errorf("migration of vmi %s off drained node %s failed", vmiObj.Name, sourceNode)
+		}
+
+		if vmiObj.Status.NodeName == sourceNode || migration == nil || !migration.Completed || vmiObj.Status.Phase != kubevirtv1.Running {
+			return false, nil
+		}
+		return vmiVolumesReady(vmiObj), nil
+	}
+
+	if err := v.waitUntilObjectIsReady(ctx, vmiObj, verifyVMIDrained); err != nil {
+		return err
+	}
+	logrus.Infof("vmi %s migrated from drained node %s to %s", vmiObj.Name, sourceNode, vmiObj.Status.NodeName)
+	return nil
+}
+
+// setNodeUnschedulable cordons or uncordons a node
+func (v *ValidationRun) setNodeUnschedulable(ctx context.Context, nodeName string, unschedulable bool) error {
+	node := &corev1.Node{}
+	if err := v.clients.runtimeClient.Get(ctx, types.NamespacedName{Name: nodeName}, node); err != nil {
+		return fmt.Errorf("error looking up node %s: %w", nodeName, err)
+	}
+
+	patch := client.MergeFrom(node.DeepCopy())
+	node.Spec.Unschedulable = unschedulable
+	if err := v.clients.runtimeClient.Patch(ctx, node, patch); err != nil {
+		return fmt.Errorf("error setting node %s unschedulable to %t: %w", nodeName, unschedulable, err)
+	}
+	return nil
+}
+
+// evictVMIPods evicts the virt-launcher pods of the vmi from the node through the eviction api.
+// kubevirt denies the eviction of a vmi which is live migratable with TooManyRequests, and
+// starts a migration in its place
+func (v *ValidationRun) evictVMIPods(ctx context.Context, vmiObj *kubevirtv1.VirtualMachineInstance, nodeName string) error {
+	podList := &corev1.PodList{}
+	if err := v.clients.runtimeClient.List(ctx, podList, client.InNamespace(vmiObj.Namespace), client.MatchingLabels{launcherPodVMILabel: string(vmiObj.UID)}); err != nil {
+		return fmt.Errorf("error listing virt-launcher pods for vmi %s: %w", vmiObj.Name, err)
+	}
+
+	for _, pod := range podList.Items {
+		if pod.Spec.NodeName != nodeName {
+			continue
+		}
+
+		eviction := &policyv1.Eviction{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      pod.Name,
+				Namespace: pod.Namespace,
+			},
+		}
+		err := v.clients.kubevirtClient.CoreV1().Pods(pod.Namespace).EvictV1(ctx, eviction)
+		if err != nil && !apierrors.IsTooManyRequests(err) && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("error evicting pod %s from node %s: %w", pod.Name, nodeName, err)
+		}
+	}
+	return nil
+}
+
+// vmiVolumesReady ensures every volume of the vmi reports a status, and hotplugged
+// volumes are ready for use by the guest
+func vmiVolumesReady(vmiObj *kubevirtv1.VirtualMachineInstance) bool {
+	statuses := make(map[string]kubevirtv1.VolumeStatus, len(vmiObj.Status.VolumeStatus))
+	for _, status := range vmiObj.Status.VolumeStatus {
+		statuses[status.Name] = status
+	}
+
+	for _, volume := range vmiObj.Spec.Volumes {
+		status, ok := statuses[volume.Name]
+		if !ok {
+			return false
+		}
+		if status.HotplugVolume != nil && status.Phase != kubevirtv1.VolumeReady {
+			return false
+		}
+	}
+	return true
+}
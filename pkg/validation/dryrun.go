@@ -0,0 +1,89 @@
+package validation
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/yaml"
+)
+
+// generatedNameSuffix is used in place of the random suffix the apiserver appends
+// to objects created with a GenerateName, as the real names are only known at creation
+const generatedNameSuffix = "xxxxx"
+
+// plannedNodeName is used in place of the nodes workloads are pinned to, which are only
+// known once the run inspects the cluster
+const plannedNodeName = "node-" + generatedNameSuffix
+
+// plannedName returns the placeholder name used to reference an object in a dry run
+func plannedName(obj client.Object) string {
+	if obj.GetName() != "" {
+		return obj.GetName()
+	}
+	return obj.GetGenerateName() + generatedNameSuffix
+}
+
+// renderPlan writes the ordered list of checks along with the manifests of every
+// object the checks would create, without submitting anything to the cluster
+func (v *ValidationRun) renderPlan(out io.Writer) error {
+	configByte, err := yaml.Marshal(redactConfiguration(*v.Configuration))
+	if err != nil {
+		return fmt.Errorf("err marshalling configuration: %w", err)
+	}
+
+	validations := v.validations()
+	fmt.Fprintln(out, "-------------------------------------")
+	fmt.Fprintln(out, "# resolved configuration")
+	for _, line := range strings.Split(strings.TrimSpace(string(configByte)), "\n") {
+		fmt.Fprintf(out, "#   %s\n", line)
+	}
+	fmt.Fprintln(out, "# planned checks")
+	for i, check := range validations {
+		if reason := v.notApplicable(check.Requires); reason != "" {
+			fmt.Fprintf(out, "#   %d. %s (not applicable: %s)\n", i+1, check.Name, reason)
+			continue
+		}
+		fmt.Fprintf(out, "#   %d. %s\n", i+1, check.Name)
+	}
+
+	for _, check := range validations {
+		if check.Plan == nil || v.notApplicable(check.Requires) != "" {
+			continue
+		}
+		for _, obj := range check.Plan() {
+			if err := setGroupVersionKind(obj); err != nil {
+				return err
+			}
+			objByte, err := yaml.Marshal(obj)
+			if err != nil {
+				return fmt.Errorf("err marshalling object %s: %w", plannedName(obj), err)
+			}
+			fmt.Fprintln(out, "---")
+			fmt.Fprintf(out, "# check: %s\n", check.Name)
+			fmt.Fprint(out, v.redactSecrets(string(objByte)))
+		}
+	}
+	return nil
+}
+
+// redactSecrets masks the guest password in the cloud-init user data of planned vms
+func (v *ValidationRun) redactSecrets(manifest string) string {
+	if v.Configuration.VMConfig.GuestPassword == "" {
+		return manifest
+	}
+	return strings.ReplaceAll(manifest, v.Configuration.VMConfig.GuestPassword, redactedValue)
+}
+
+// setGroupVersionKind populates TypeMeta from the scheme, as typed objects
+// do not carry apiVersion and kind unless read back from the apiserver
+func setGroupVersionKind(obj client.Object) error {
+	gvk, err := apiutil.GVKForObject(obj, scheme)
+	if err != nil {
+		return fmt.Errorf("error looking up kind for object %s: %w", plannedName(obj), err)
+	}
+	obj.GetObjectKind().SetGroupVersionKind(gvk)
+	return nil
+}
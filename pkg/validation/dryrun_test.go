@@ -0,0 +1,52 @@
+package validation
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	storagev1 "k8s.io/api/storage/v1"
+
+	"github.com/harvester/storage-validator/pkg/api"
+)
+
+func Test_RenderPlan(t *testing.T) {
+	assert := require.New(t)
+	v := &ValidationRun{
+		Configuration: &api.Configuration{
+			Namespace:     "default",
+			ImageURL:      "http://localhost/image.qcow2",
+			StorageClass:  "lvm",
+			SnapshotClass: "lvm-snapshot",
+			VMConfig: api.VMSpec{
+				CPU:           DefaultCPU,
+				Memory:        DefaultMem,
+				DiskSize:      DefaultDiskSize,
+				GuestUser:     DefaultGuestUser,
+				GuestPassword: "guest-secret",
+			},
+			ImageSources: api.ImageSourcesSpec{
+				HarvesterURL:   "https://192.168.1.10",
+				HarvesterToken: "token-secret",
+			},
+		},
+		storageClass: &storagev1.StorageClass{
+			Provisioner: "lvm.driver.harvesterhci.io",
+		},
+	}
+
+	out := &bytes.Buffer{}
+	assert.NoError(v.renderPlan(out))
+	for _, kind := range []string{"PersistentVolumeClaim", "Pod", "VolumeSnapshot", "VirtualMachineImage", "DataVolume", "VirtualMachine", "VirtualMachineInstanceMigration"} {
+		assert.Contains(out.String(), "kind: "+kind)
+	}
+	// objects created later in the plan reference the placeholder names of earlier objects
+	assert.Contains(out.String(), "claimName: pvc-storage-validation-"+generatedNameSuffix)
+	assert.Contains(out.String(), "vmiName: vm-storage-validation-"+generatedNameSuffix)
+	// the guest password is masked in the resolved configuration and the cloud-init user data
+	assert.NotContains(out.String(), "guest-secret")
+	assert.Contains(out.String(), "guestPassword: "+redactedValue)
+	assert.Contains(out.String(), DefaultGuestUser+":"+redactedValue)
+	assert.NotContains(out.String(), "token-secret")
+	assert.Contains(out.String(), "harvesterToken: "+redactedValue)
+}
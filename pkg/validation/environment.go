@@ -0,0 +1,153 @@
+package validation
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	harvesterv1beta1 "github.com/harvester/harvester/pkg/apis/harvesterhci.io/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/harvester/storage-validator/pkg/api"
+)
+
+// fetchEnvironmentInfo identifies the versions of the components making up the stack under
+// validation, along with the nodes and the csi driver of the storage class
+func (v *ValidationRun) fetchEnvironmentInfo() (api.EnvironmentInfo, error) {
+	envInfo := api.EnvironmentInfo{ValidatorVersion: v.Version}
+
+	setting := &harvesterv1beta1.Setting{}
+	if err := v.clients.runtimeClient.Get(v.ctx, types.NamespacedName{Name: ServerVersionSetting, Namespace: ""}, setting); err != nil {
+		return envInfo, fmt.Errorf("error fetching harvester version: %w", err)
+	}
+	envInfo.HarvesterVersion = setting.Value
+
+	serverVersion, err := v.clients.kubevirtClient.DiscoveryClient().ServerVersion()
+	if err != nil {
+		return envInfo, fmt.Errorf("error fetching kubernetes version: %w", err)
+	}
+	envInfo.KubernetesVersion = serverVersion.GitVersion
+
+	kv, err := v.kubeVirt(v.ctx)
+	if err != nil {
+		return envInfo, err
+	}
+	envInfo.KubeVirtVersion = kv.Status.ObservedKubeVirtVersion
+
+	cdi, err := v.cdi(v.ctx)
+	if err != nil {
+		return envInfo, err
+	}
+	envInfo.CDIVersion = cdi.Status.ObservedVersion
+
+	manager, err := v.longhornManager(v.ctx)
+	if err != nil {
+		return envInfo, err
+	}
+	for _, container := range manager.Spec.Template.Spec.Containers {
+		if container.Name == longhornManager {
+			envInfo.LonghornVersion = imageTag(container.Image)
+		}
+	}
+
+	podList := &corev1.PodList{}
+	if err := v.clients.runtimeClient.List(v.ctx, podList); err != nil {
+		return envInfo, fmt.Errorf("error listing pods: %w", err)
+	}
+	envInfo.CSIDriver = csiDriverInfo(v.storageClass.Provisioner, podList.Items)
+
+	nodeList := &corev1.NodeList{}
+	if err := v.clients.runtimeClient.List(v.ctx, nodeList); err != nil {
+		return envInfo, fmt.Errorf("error listing nodes in cluster: %w", err)
+	}
+	envInfo.NodeCount = len(nodeList.Items)
+
+	csiNodeList := &storagev1.CSINodeList{}
+	if err := v.clients.runtimeClient.List(v.ctx, csiNodeList); err != nil {
+		return envInfo, fmt.Errorf("error listing csinodes: %w", err)
+	}
+	csiNodes := make(map[string]storagev1.CSINode, len(csiNodeList.Items))
+	for _, csiNode := range csiNodeList.Items {
+		csiNodes[csiNode.Name] = csiNode
+	}
+	for _, node := range nodeList.Items {
+		envInfo.Nodes = append(envInfo.Nodes, nodeInfo(node, csiNodes[node.Name]))
+	}
+	sort.Slice(envInfo.Nodes, func(i, j int) bool {
+		return envInfo.Nodes[i].Name < envInfo.Nodes[j].Name
+	})
+	return envInfo, nil
+}
+
+// csiDriverInfo collects the distinct images of the node plugin and controller pods of the driver
+func csiDriverInfo(driverName string, pods []corev1.Pod) api.CSIDriverInfo {
+	info := api.CSIDriverInfo{Name: driverName}
+	images := map[string]bool{}
+	for i := range pods {
+		if !isCSINodePlugin(&pods[i], driverName) && !isCSIController(&pods[i], driverName) {
+			continue
+		}
+		for _, container := range pods[i].Spec.Containers {
+			images[container.Image] = true
+		}
+	}
+	for image := range images {
+		info.Images = append(info.Images, image)
+	}
+	sort.Strings(info.Images)
+	return info
+}
+
+// isCSIController identifies the pods running the provisioner, attacher, resizer and snapshotter
+// sidecars of the driver, which connect to the driver through the --csi-address argument. the
+// driver is referenced by name in the arguments or environment of the containers, or in the
+// host path of the socket shared with the node plugin
+func isCSIController(pod *corev1.Pod, driverName string) bool {
+	var sidecar, driver bool
+	for _, container := range pod.Spec.Containers {
+		values := append(append([]string{}, container.Command...), container.Args...)
+		for _, env := range container.Env {
+			values = append(values, env.Value)
+		}
+		for _, value := range values {
+			sidecar = sidecar || strings.HasPrefix(value, "--csi-address")
+			driver = driver || strings.Contains(value, driverName)
+		}
+	}
+	for _, volume := range pod.Spec.Volumes {
+		if volume.HostPath != nil && strings.Contains(volume.HostPath.Path, "/"+driverName) {
+			driver = true
+		}
+	}
+	return sidecar && driver
+}
+
+// nodeInfo captures the node details reported by the kubelet, and the drivers registered in its CSINode
+func nodeInfo(node corev1.Node, csiNode storagev1.CSINode) api.NodeInfo {
+	info := api.NodeInfo{
+		Name:             node.Name,
+		OSImage:          node.Status.NodeInfo.OSImage,
+		KernelVersion:    node.Status.NodeInfo.KernelVersion,
+		ContainerRuntime: node.Status.NodeInfo.ContainerRuntimeVersion,
+		Architecture:     node.Status.NodeInfo.Architecture,
+	}
+	for _, driver := range csiNode.Spec.Drivers {
+		nodeDriver := api.CSINodeDriver{Name: driver.Name, NodeID: driver.NodeID}
+		if driver.Allocatable != nil {
+			nodeDriver.AllocatableCount = driver.Allocatable.Count
+		}
+		info.CSIDrivers = append(info.CSIDrivers, nodeDriver)
+	}
+	return info
+}
+
+// imageTag returns the tag of the image, or the image itself if it is not tagged
+func imageTag(image string) string {
+	image, _, _ = strings.Cut(image, "@")
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image[i+1:]
+	}
+	return image
+}
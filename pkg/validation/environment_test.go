@@ -0,0 +1,108 @@
+package validation
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+
+	"github.com/harvester/storage-validator/pkg/api"
+)
+
+func Test_ImageTag(t *testing.T) {
+	assert := require.New(t)
+	assert.Equal("v1.7.2", imageTag("longhornio/longhorn-manager:v1.7.2"))
+	assert.Equal("v1.7.2", imageTag("registry.local:5000/longhornio/longhorn-manager:v1.7.2"))
+	assert.Equal("registry.local:5000/longhornio/longhorn-manager", imageTag("registry.local:5000/longhornio/longhorn-manager"))
+	assert.Equal("v1.7.2", imageTag("longhornio/longhorn-manager:v1.7.2@sha256:abcd"))
+}
+
+func Test_CSIDriverInfo(t *testing.T) {
+	assert := require.New(t)
+	plugin := corev1.Pod{
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Image: "longhornio/csi-node-driver-registrar:v2.12.0",
+					Args:  []string{"--kubelet-registration-path=/var/lib/kubelet/plugins/driver.longhorn.io/csi.sock"},
+				},
+				{Image: "longhornio/longhorn-manager:v1.7.2"},
+			},
+		},
+	}
+	// the controller sidecars reach the driver socket through a host path named after the driver
+	provisioner := corev1.Pod{
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Image: "longhornio/csi-provisioner:v5.1.0",
+					Args:  []string{"--csi-address=$(ADDRESS)"},
+				},
+			},
+			Volumes: []corev1.Volume{
+				{
+					Name:         "socket-dir",
+					VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: "/var/lib/kubelet/plugins/driver.longhorn.io"}},
+				},
+			},
+		},
+	}
+	// the controller of another driver, naming it in its arguments
+	otherController := corev1.Pod{
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{Image: "quay.io/cephcsi/cephcsi:v3.13.0", Args: []string{"--drivername=rbd.csi.ceph.com"}},
+				{Image: "registry.k8s.io/sig-storage/csi-attacher:v4.8.0", Args: []string{"--csi-address=unix:///csi/csi-provisioner.sock"}},
+			},
+		},
+	}
+	other := corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{Image: "nginx"}}}}
+
+	assert.Equal(api.CSIDriverInfo{
+		Name: "driver.longhorn.io",
+		Images: []string{
+			"longhornio/csi-node-driver-registrar:v2.12.0",
+			"longhornio/csi-provisioner:v5.1.0",
+			"longhornio/longhorn-manager:v1.7.2",
+		},
+	}, csiDriverInfo("driver.longhorn.io", []corev1.Pod{plugin, plugin, provisioner, otherController, other}))
+
+	assert.Equal(api.CSIDriverInfo{
+		Name:   "rbd.csi.ceph.com",
+		Images: []string{"quay.io/cephcsi/cephcsi:v3.13.0", "registry.k8s.io/sig-storage/csi-attacher:v4.8.0"},
+	}, csiDriverInfo("rbd.csi.ceph.com", []corev1.Pod{plugin, provisioner, otherController}))
+}
+
+func Test_NodeInfo(t *testing.T) {
+	assert := require.New(t)
+	node := corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+		Status: corev1.NodeStatus{
+			NodeInfo: corev1.NodeSystemInfo{
+				OSImage:                 "Harvester v1.6.0",
+				KernelVersion:           "6.4.0-150600.23.42-default",
+				ContainerRuntimeVersion: "containerd://2.0.5-k3s1",
+				Architecture:            "amd64",
+			},
+		},
+	}
+	csiNode := storagev1.CSINode{
+		Spec: storagev1.CSINodeSpec{
+			Drivers: []storagev1.CSINodeDriver{
+				{Name: "driver.longhorn.io", NodeID: "node-1", Allocatable: &storagev1.VolumeNodeResources{Count: ptr.To(int32(32))}},
+			},
+		},
+	}
+
+	assert.Equal(api.NodeInfo{
+		Name:             "node-1",
+		OSImage:          "Harvester v1.6.0",
+		KernelVersion:    "6.4.0-150600.23.42-default",
+		ContainerRuntime: "containerd://2.0.5-k3s1",
+		Architecture:     "amd64",
+		CSIDrivers:       []api.CSINodeDriver{{Name: "driver.longhorn.io", NodeID: "node-1", AllocatableCount: ptr.To(int32(32))}},
+	}, nodeInfo(node, csiNode))
+}
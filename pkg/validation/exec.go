@@ -0,0 +1,39 @@
+package validation
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// execInPod runs the command in the container of the pod and returns its stdout.
+// an error including stderr is returned if the command fails
+func (v *ValidationRun) execInPod(ctx context.Context, pod *corev1.Pod, container string, command []string) (string, error) {
+	req := v.clients.kubevirtClient.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Name(pod.Name).
+		Namespace(pod.Namespace).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: container,
+			Command:   command,
+			Stdout:    true,
+			Stderr:    true,
+		}, clientgoscheme.ParameterCodec)
+
+	executor, err := remotecommand.NewSPDYExecutor(v.cfg, "POST", req.URL())
+	if err != nil {
+		return "", fmt.Errorf("error setting up exec in pod %s: %w", pod.Name, err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if err := executor.StreamWithContext(ctx, remotecommand.StreamOptions{Stdout: &stdout, Stderr: &stderr}); err != nil {
+		return stdout.String(), fmt.Errorf("error running %q in pod %s: %w: %s", strings.Join(command, " "), pod.Name, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
@@ -0,0 +1,160 @@
+package validation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	kubevirtv1 "kubevirt.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/harvester/storage-validator/pkg/api"
+)
+
+const (
+	// staleAttachmentTimeout is how long the VolumeAttachments of the lost vmi are given to be
+	// removed once the vm has recovered, before they are reported as stale
+	staleAttachmentTimeout = 2 * time.Minute
+	failedAttachReason     = "FailedAttachVolume"
+)
+
+// forceDeleteVMLauncher simulates the abrupt loss of the host running the validation vm by
+// force deleting its virt-launcher pod. the RerunOnFailure run strategy of the vm is expected
+// to start a new vmi with the boot volume reattached. multi-attach errors reported while the
+// volume is reattached, and VolumeAttachments left behind for the lost vmi are reported
+func (v *ValidationRun) forceDeleteVMLauncher(ctx context.Context) error {
+	vmiObj := &kubevirtv1.VirtualMachineInstance{}
+	if err := v.clients.runtimeClient.Get(ctx, types.NamespacedName{Name: v.vmName, Namespace: v.Configuration.Namespace}, vmiObj); err != nil {
+		return fmt.Errorf("error looking up vmi %s: %w", v.vmName, err)
+	}
+	lostUID := vmiObj.UID
+	result := &api.FailoverResult{SourceNode: vmiObj.Status.NodeName}
+	v.Report.Failover = result
+
+	podList := &corev1.PodList{}
+	if err := v.clients.runtimeClient.List(ctx, podList, client.InNamespace(vmiObj.Namespace), client.MatchingLabels{launcherPodVMILabel: string(lostUID)}); err != nil {
+		return fmt.Errorf("error listing virt-launcher pods for vmi %s: %w", vmiObj.Name, err)
+	}
+	if len(podList.Items) == 0 {
+		return fmt.Errorf("no virt-launcher pod found for vmi %s", vmiObj.Name)
+	}
+
+	start := time.Now()
+	for i := range podList.Items {
+		pod := &podList.Items[i]
+		if err := v.clients.runtimeClient.Delete(ctx, pod, client.GracePeriodSeconds(0)); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("error force deleting pod %s: %w", pod.Name, err)
+		}
+		logrus.Infof("force deleted virt-launcher pod %s on node %s", pod.Name, pod.Spec.NodeName)
+	}
+
+	verifyVMIRecovered := func(obj client.Object) (bool, error) {
+		vmiObj, ok := obj.(*kubevirtv1.VirtualMachineInstance)
+		if !ok {
+			return false, fmt.Errorf("error asserting object %v to vmi", client.ObjectKeyFromObject(obj))
+		}
+		if vmiObj.UID == lostUID || vmiObj.Status.Phase != kubevirtv1.Running {
+			return false, nil
+		}
+		return vmiVolumesReady(vmiObj), nil
+	}
+	recovered := &kubevirtv1.VirtualMachineInstance{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      v.vmName,
+			Namespace: v.Configuration.Namespace,
+		},
+	}
+	waitErr := v.waitUntilObjectIsReady(ctx, recovered, verifyVMIRecovered)
+
+	// multi-attach errors are collected even when the vm did not recover, as they explain why
+	if err := v.collectMultiAttachErrors(ctx, recovered, result); err != nil {
+		logrus.Warnf("%v", err)
+	}
+	if waitErr != nil {
+		return waitErr
+	}
+
+	result.RecoverySeconds = time.Since(start).Round(time.Second).Seconds()
+	result.TargetNode = recovered.Status.NodeName
+	logrus.Infof("vm %s recovered on node %s in %.0fs after its virt-launcher pod was force deleted", v.vmName, result.TargetNode, result.RecoverySeconds)
+	for _, msg := range result.MultiAttachErrors {
+		logrus.Warnf("multi-attach error while vm %s recovered: %s", v.vmName, msg)
+	}
+
+	if err := v.waitForStaleAttachments(ctx, result); err != nil {
+		return err
+	}
+	if len(result.StaleAttachments) > 0 {
+		return fmt.Errorf("volumeattachments of the lost vmi were not removed: %s", strings.Join(result.StaleAttachments, ", "))
+	}
+	return nil
+}
+
+// collectMultiAttachErrors records the multi-attach errors reported against the virt-launcher pods of the vmi
+func (v *ValidationRun) collectMultiAttachErrors(ctx context.Context, vmiObj *kubevirtv1.VirtualMachineInstance, result *api.FailoverResult) error {
+	if vmiObj.UID == "" {
+		return nil
+	}
+
+	podList := &corev1.PodList{}
+	if err := v.clients.runtimeClient.List(ctx, podList, client.InNamespace(vmiObj.Namespace), client.MatchingLabels{launcherPodVMILabel: string(vmiObj.UID)}); err != nil {
+		return fmt.Errorf("error listing virt-launcher pods for vmi %s: %w", vmiObj.Name, err)
+	}
+
+	for i := range podList.Items {
+		events, err := v.warningEvents(ctx, &podList.Items[i])
+		if err != nil {
+			return err
+		}
+		for _, event := range events {
+			if event.Reason == failedAttachReason && strings.Contains(event.Message, "Multi-Attach") {
+				result.MultiAttachErrors = append(result.MultiAttachErrors, event.Message)
+			}
+		}
+	}
+	return nil
+}
+
+// waitForStaleAttachments waits for VolumeAttachments of the boot volume on nodes other than
+// the one running the recovered vmi to be removed, and records those which remain
+func (v *ValidationRun) waitForStaleAttachments(ctx context.Context, result *api.FailoverResult) error {
+	pvc := &corev1.PersistentVolumeClaim{}
+	if err := v.clients.runtimeClient.Get(ctx, types.NamespacedName{Name: v.bootPVCName, Namespace: v.Configuration.Namespace}, pvc); err != nil {
+		return fmt.Errorf("error looking up pvc %s: %w", v.bootPVCName, err)
+	}
+
+	attachmentList := &storagev1.VolumeAttachmentList{}
+	if err := v.clients.runtimeClient.List(ctx, attachmentList); err != nil {
+		return fmt.Errorf("error listing volumeattachments: %w", err)
+	}
+
+	staleCtx, cancel := context.WithTimeout(ctx, staleAttachmentTimeout)
+	defer cancel()
+	for i := range attachmentList.Items {
+		attachment := &attachmentList.Items[i]
+		pvName := attachment.Spec.Source.PersistentVolumeName
+		if pvName == nil || *pvName != pvc.Spec.VolumeName || attachment.Spec.NodeName == result.TargetNode {
+			continue
+		}
+
+		err := v.waitUntilObjectIsDeleted(staleCtx, attachment)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			if !errors.Is(err, context.DeadlineExceeded) {
+				return err
+			}
+			result.StaleAttachments = append(result.StaleAttachments, fmt.Sprintf("%s on node %s", attachment.Name, attachment.Spec.NodeName))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+package validation
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	kvcorev1 "kubevirt.io/client-go/kubevirt/typed/core/v1"
+)
+
+const (
+	guestLoginPrompt    = "login:"
+	guestPasswordPrompt = "Password:"
+	guestLoginFailed    = "Login incorrect"
+	guestLoginRetry     = 10 * time.Second
+	guestConsoleTimeout = time.Minute
+)
+
+// guestSession runs shell commands in the guest of a vmi over its serial console.
+// the guest credentials are injected through cloud-init when the vm is created
+type guestSession struct {
+	vmiName string
+	stream  kvcorev1.StreamInterface
+	in      *io.PipeWriter
+	mu      sync.Mutex
+	output  strings.Builder
+	updated chan struct{}
+	closed  chan struct{}
+	err     error
+}
+
+// guestUserData generates cloud-init user data setting the password of the guest user
+func (v *ValidationRun) guestUserData() string {
+	return fmt.Sprintf(`#cloud-config
+ssh_pwauth: false
+chpasswd:
+  expire: false
+  list: |
+    %s:%s
+`, v.Configuration.VMConfig.GuestUser, v.Configuration.VMConfig.GuestPassword)
+}
+
+// openGuestSession connects to the serial console of the vmi and logs in to the guest.
+// login is retried until the context expires, as the guest may still be booting or
+// cloud-init may not have applied the credentials yet
+func (v *ValidationRun) openGuestSession(ctx context.Context, vmiName string) (*guestSession, error) {
+	stream, err := v.clients.kubevirtClient.VirtualMachineInstance(v.Configuration.Namespace).SerialConsole(vmiName, &kvcorev1.SerialConsoleOptions{ConnectionTimeout: guestConsoleTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to serial console of vmi %s: %w", vmiName, err)
+	}
+
+	inReader, inWriter := io.Pipe()
+	g := &guestSession{
+		vmiName: vmiName,
+		stream:  stream,
+		in:      inWriter,
+		updated: make(chan struct{}, 1),
+		closed:  make(chan struct{}),
+	}
+
+	go func() {
+		err := stream.Stream(kvcorev1.StreamOptions{In: inReader, Out: g})
+		// unblock writers once the console is disconnected
+		inReader.CloseWithError(io.ErrClosedPipe)
+		g.mu.Lock()
+		g.err = err
+		g.mu.Unlock()
+		close(g.closed)
+	}()
+
+	if err := g.login(ctx, v.Configuration.VMConfig.GuestUser, v.Configuration.VMConfig.GuestPassword); err != nil {
+		g.close()
+		return nil, err
+	}
+	return g, nil
+}
+
+// Write receives output from the serial console
+func (g *guestSession) Write(p []byte) (int, error) {
+	g.mu.Lock()
+	g.output.Write(p)
+	g.mu.Unlock()
+	select {
+	case g.updated <- struct{}{}:
+	default:
+	}
+	return len(p), nil
+}
+
+// close logs out of the guest, leaving the console at the login prompt for the next session
+func (g *guestSession) close() {
+	_ = g.send("exit\n")
+	g.in.Close()
+	if conn := g.stream.AsConn(); conn != nil {
+		conn.Close()
+	}
+}
+
+func (g *guestSession) send(input string) error {
+	if _, err := g.in.Write([]byte(input)); err != nil {
+		return fmt.Errorf("error writing to serial console of vmi %s: %w", g.vmiName, err)
+	}
+	return nil
+}
+
+// expect waits until the console output after offset matches the pattern, and returns
+// the submatches along with the offset after the match
+func (g *guestSession) expect(ctx context.Context, offset int, pattern *regexp.Regexp) ([]string, int, error) {
+	for {
+		g.mu.Lock()
+		output := g.output.String()
+		streamErr := g.err
+		g.mu.Unlock()
+
+		if offset < len(output) {
+			if loc := pattern.FindStringSubmatchIndex(output[offset:]); loc != nil {
+				var matches []string
+				for i := 0; i+1 < len(loc); i += 2 {
+					if loc[i] < 0 {
+						matches = append(matches, "")
+						continue
+					}
+					matches = append(matches, output[offset+loc[i]:offset+loc[i+1]])
+				}
+				return matches, offset + loc[1], nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, offset, fmt.Errorf("timed out waiting for %q on serial console of vmi %s: %w", pattern.String(), g.vmiName, ctx.Err())
+		case <-g.closed:
+			return nil, offset, fmt.Errorf("serial console of vmi %s closed: %v", g.vmiName, streamErr)
+		case <-g.updated:
+		}
+	}
+}
+
+func (g *guestSession) offset() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.output.Len()
+}
+
+func (g *guestSession) login(ctx context.Context, user, password string) error {
+	loginPattern := regexp.MustCompile(regexp.QuoteMeta(guestLoginPrompt))
+	passwordPattern := regexp.MustCompile(regexp.QuoteMeta(guestPasswordPrompt))
+	resultPattern := regexp.MustCompile(`(` + regexp.QuoteMeta(guestLoginFailed) + `|[#$] ?$)`)
+	for {
+		offset := g.offset()
+		// a newline triggers the login prompt to be printed again
+		if err := g.send("\n"); err != nil {
+			return err
+		}
+		if _, _, err := g.expect(ctx, offset, loginPattern); err != nil {
+			return err
+		}
+
+		offset = g.offset()
+		if err := g.send(user + "\n"); err != nil {
+			return err
+		}
+		if _, _, err := g.expect(ctx, offset, passwordPattern); err != nil {
+			return err
+		}
+
+		offset = g.offset()
+		if err := g.send(password + "\n"); err != nil {
+			return err
+		}
+		matches, _, err := g.expect(ctx, offset, resultPattern)
+		if err != nil {
+			return err
+		}
+
+		if matches[1] != guestLoginFailed {
+			break
+		}
+
+		logrus.Debugf("login to vmi %s failed, retrying in %s", g.vmiName, guestLoginRetry)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out logging in to vmi %s: %w", g.vmiName, ctx.Err())
+		case <-time.After(guestLoginRetry):
+		}
+	}
+
+	// disable echo and line wrapping to simplify parsing of command output
+	_, err := g.run(ctx, "stty -echo cols 1000")
+	return err
+}
+
+// run executes a shell command in the guest and returns its combined output.
+// an error is returned if the command exits with a non zero status
+func (g *guestSession) run(ctx context.Context, command string) (string, error) {
+	token := randomToken()
+	begin := "SVBEGIN-" + token
+	end := "SVEND-" + token
+
+	offset := g.offset()
+	// markers are split in the command line so an echoed command does not match them
+	line := fmt.Sprintf("echo %s''%s; ( %s ) 2>&1; echo %s''%s-$?\n", begin[:2], begin[2:], command, end[:2], end[2:])
+	if err := g.send(line); err != nil {
+		return "", err
+	}
+
+	matches, _, err := g.expect(ctx, offset, regexp.MustCompile(`(?s)`+begin+`\r?\n(.*?)`+end+`-(\d+)`))
+	if err != nil {
+		return "", err
+	}
+
+	output := strings.ReplaceAll(matches[1], "\r", "")
+	exitCode, _ := strconv.Atoi(matches[2])
+	if exitCode != 0 {
+		return output, fmt.Errorf("command %q in vmi %s exited with %d: %s", command, g.vmiName, exitCode, strings.TrimSpace(output))
+	}
+	return output, nil
+}
+
+func randomToken() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
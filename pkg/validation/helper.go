@@ -2,36 +2,222 @@ package validation
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
+	"net"
 	"time"
 
 	"github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
 
 	"github.com/harvester/storage-validator/pkg/api"
 )
 
 // fetch and verify that specified object is ready
-// else keep retrying till verification times out
+// else watch the object and re-verify on every change till verification times out.
+// an error returned by the check is final and returned immediately, while transient
+// api errors fetching or watching the object are retried with a backoff. the observed
+// status of the object along with any Warning events are reported while waiting
 func (v *ValidationRun) waitUntilObjectIsReady(ctx context.Context, obj client.Object, check func(obj client.Object) (bool, error)) error {
+	key := client.ObjectKeyFromObject(obj)
+	backoff := newWaitBackoff()
+	var lastStatus string
 	for {
-		err := v.clients.runtimeClient.Get(ctx, client.ObjectKeyFromObject(obj), obj)
-		if err != nil {
-			return fmt.Errorf("error getting object %v: %w", client.ObjectKeyFromObject(obj), err)
+		found, err := v.fetchObject(ctx, obj)
+		if err == nil && found {
+			ready, checkErr := check(obj)
+			if checkErr != nil {
+				return v.newWaitError(obj, checkErr)
+			}
+			if ready {
+				return nil
+			}
+		}
+
+		if err == nil {
+			backoff = newWaitBackoff()
+			lastStatus = v.reportProgress(ctx, obj, lastStatus)
+			err = v.waitForObjectChange(ctx, obj)
+		}
+
+		if ctx.Err() != nil {
+			return v.newWaitError(obj, fmt.Errorf("timed out waiting for %s %v, last observed state %q: %w", objectKind(obj), key, lastStatus, ctx.Err()))
 		}
 
-		ready, err := check(obj)
 		if err != nil {
-			return err
+			if !isTransientError(err) {
+				return v.newWaitError(obj, err)
+			}
+			delay := backoff.Step()
+			logrus.Warnf("transient error waiting for %s %v, retrying in %s: %v", objectKind(obj), key, delay, err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(delay):
+			}
 		}
-		if !ready {
-			logrus.Debugf("waiting for object %v to reach desired state\n", client.ObjectKeyFromObject(obj))
-			time.Sleep(5 * time.Second)
-		} else {
+	}
+}
+
+// waitUntilObjectIsDeleted watches the object until it is no longer found, reporting
+// progress and retrying transient errors in the same way as waitUntilObjectIsReady
+func (v *ValidationRun) waitUntilObjectIsDeleted(ctx context.Context, obj client.Object) error {
+	key := client.ObjectKeyFromObject(obj)
+	backoff := newWaitBackoff()
+	var lastStatus string
+	for {
+		found, err := v.fetchObject(ctx, obj)
+		if err == nil && !found {
 			return nil
 		}
 
+		if err == nil {
+			backoff = newWaitBackoff()
+			lastStatus = v.reportProgress(ctx, obj, lastStatus)
+			err = v.waitForObjectChange(ctx, obj)
+		}
+
+		if ctx.Err() != nil {
+			return v.newWaitError(obj, fmt.Errorf("timed out waiting for deletion of %s %v, last observed state %q: %w", objectKind(obj), key, lastStatus, ctx.Err()))
+		}
+
+		if err != nil {
+			if !isTransientError(err) {
+				return v.newWaitError(obj, err)
+			}
+			delay := backoff.Step()
+			logrus.Warnf("transient error waiting for deletion of %s %v, retrying in %s: %v", objectKind(obj), key, delay, err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(delay):
+			}
+		}
+	}
+}
+
+// fetchObject fetches the latest version of the object, and reports whether it was found.
+// an object which is not found has its uid cleared, so it is reported as not found
+func (v *ValidationRun) fetchObject(ctx context.Context, obj client.Object) (bool, error) {
+	err := v.clients.runtimeClient.Get(ctx, client.ObjectKeyFromObject(obj), obj)
+	if apierrors.IsNotFound(err) {
+		obj.SetUID("")
+		obj.SetResourceVersion("")
+		return false, nil
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("error getting object %v: %w", client.ObjectKeyFromObject(obj), err)
+	}
+	return true, nil
+}
+
+// waitForObjectChange blocks until the object is modified, or the resync interval
+// elapses to ensure the object and its events are periodically re-evaluated
+func (v *ValidationRun) waitForObjectChange(ctx context.Context, obj client.Object) error {
+	list, err := newListForObject(obj)
+	if err != nil {
+		return err
+	}
+
+	watcher, err := v.clients.runtimeClient.Watch(ctx, list, &client.ListOptions{
+		Namespace:     obj.GetNamespace(),
+		FieldSelector: fields.OneTermEqualSelector("metadata.name", obj.GetName()),
+		Raw: &metav1.ListOptions{
+			ResourceVersion: obj.GetResourceVersion(),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("error watching object %v: %w", client.ObjectKeyFromObject(obj), err)
+	}
+	defer watcher.Stop()
+
+	resync := time.NewTimer(waitResyncInterval)
+	defer resync.Stop()
+
+	select {
+	case <-ctx.Done():
+	case <-resync.C:
+	case event, ok := <-watcher.ResultChan():
+		if ok && event.Type == watch.Error {
+			return fmt.Errorf("error watching object %v: %w", client.ObjectKeyFromObject(obj), apierrors.FromObject(event.Object))
+		}
+	}
+	return nil
+}
+
+// reportProgress logs the observed status and latest Warning event of an object
+// while waiting for it, and returns the reported status
+func (v *ValidationRun) reportProgress(ctx context.Context, obj client.Object, lastStatus string) string {
+	status := describeObjectStatus(obj)
+	if obj.GetUID() == "" {
+		status = fmt.Sprintf("%s not found", objectKind(obj))
+	}
+
+	events, err := v.warningEvents(ctx, obj)
+	if err != nil {
+		logrus.Debugf("%v", err)
+	}
+	if len(events) > 0 {
+		status = fmt.Sprintf("%s: %s: %s", status, events[0].Reason, events[0].Message)
+	}
+
+	if status != lastStatus {
+		logrus.Infof("waiting for %s %v: %s", objectKind(obj), client.ObjectKeyFromObject(obj), status)
+	} else {
+		logrus.Debugf("waiting for object %v to reach desired state", client.ObjectKeyFromObject(obj))
+	}
+	return status
+}
+
+// newListForObject returns an empty list type matching the object from the scheme
+func newListForObject(obj client.Object) (client.ObjectList, error) {
+	gvk, err := apiutil.GVKForObject(obj, scheme)
+	if err != nil {
+		return nil, fmt.Errorf("error looking up kind for object %v: %w", client.ObjectKeyFromObject(obj), err)
+	}
+
+	listObj, err := scheme.New(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+	if err != nil {
+		return nil, fmt.Errorf("error creating list for kind %s: %w", gvk.Kind, err)
+	}
+
+	list, ok := listObj.(client.ObjectList)
+	if !ok {
+		return nil, fmt.Errorf("error asserting %s to object list", gvk.Kind)
+	}
+	return list, nil
+}
+
+func newWaitBackoff() wait.Backoff {
+	return wait.Backoff{
+		Duration: time.Second,
+		Factor:   2,
+		Jitter:   0.1,
+		Steps:    math.MaxInt32,
+		Cap:      waitResyncInterval,
+	}
+}
+
+// isTransientError identifies errors fetching or watching objects which are worth
+// retrying, such as apiserver timeouts, throttling, expired watches and connection failures
+func isTransientError(err error) bool {
+	var netErr net.Error
+	switch {
+	case apierrors.IsServerTimeout(err), apierrors.IsTimeout(err), apierrors.IsTooManyRequests(err),
+		apierrors.IsServiceUnavailable(err), apierrors.IsInternalError(err),
+		apierrors.IsResourceExpired(err), apierrors.IsGone(err):
+		return true
+	case errors.As(err, &netErr), utilnet.IsConnectionRefused(err), utilnet.IsConnectionReset(err), utilnet.IsProbableEOF(err):
+		return true
 	}
+	return false
 }
 
 func (v *ValidationRun) AddResult(result api.Result) {
@@ -3,7 +3,9 @@ package validation
 import (
 	"context"
 	"fmt"
+	"strings"
 
+	"github.com/sirupsen/logrus"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -11,50 +13,27 @@ import (
 	"k8s.io/utils/ptr"
 	kubevirtv1 "kubevirt.io/api/core/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
-)
 
-func (v *ValidationRun) hotPlugVolume(ctx context.Context) error {
+	"github.com/harvester/storage-validator/pkg/api"
+)
 
-	pvcList := []*corev1.PersistentVolumeClaim{
-		{
-			ObjectMeta: metav1.ObjectMeta{
-				GenerateName: "hotplug-storage-validation-",
-				Namespace:    v.Configuration.Namespace,
-			},
-			Spec: corev1.PersistentVolumeClaimSpec{
-				AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteMany},
-				StorageClassName: ptr.To(v.Configuration.StorageClass),
-				Resources: corev1.VolumeResourceRequirements{
-					Requests: map[corev1.ResourceName]resource.Quantity{
-						corev1.ResourceStorage: resource.MustParse(DefaultPVCSize),
-					},
-				},
-				VolumeMode: ptr.To(corev1.PersistentVolumeBlock),
-			},
-		},
-		{
-			ObjectMeta: metav1.ObjectMeta{
-				GenerateName: "hotplug-storage-validation-",
-				Namespace:    v.Configuration.Namespace,
-			},
-			Spec: corev1.PersistentVolumeClaimSpec{
-				AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteMany},
-				StorageClassName: ptr.To(v.Configuration.StorageClass),
-				Resources: corev1.VolumeResourceRequirements{
-					Requests: map[corev1.ResourceName]resource.Quantity{
-						corev1.ResourceStorage: resource.MustParse(DefaultPVCSize),
-					},
-				},
-				VolumeMode: ptr.To(corev1.PersistentVolumeBlock),
-			},
-		},
-	}
+// hotplugDisk is a pvc hot plugged to the validation vm with a specific disk bus
+type hotplugDisk struct {
+	name string
+	bus  kubevirtv1.DiskBus
+	pvc  *corev1.PersistentVolumeClaim
+}
 
-	for _, pvc := range pvcList {
-		if err := v.clients.runtimeClient.Create(ctx, pvc); err != nil {
+// hotPlugVolume hot plugs a block and a filesystem mode pvc to the validation vm over every
+// configured disk bus, live migrates the vm while the disks are attached, and unplugs the
+// disks ensuring they are detached from the vmi and the attachment pods are removed
+func (v *ValidationRun) hotPlugVolume(ctx context.Context) error {
+	disks := v.newHotplugDisks()
+	for _, disk := range disks {
+		if err := v.clients.runtimeClient.Create(ctx, disk.pvc); err != nil {
 			return fmt.Errorf("error creating pvc: %w", err)
 		}
-		v.createdObjects = append(v.createdObjects, pvc)
+		v.createdObjects = append(v.createdObjects, disk.pvc)
 	}
 
 	// hotplug pvc to vm
@@ -63,38 +42,180 @@ func (v *ValidationRun) hotPlugVolume(ctx context.Context) error {
 		return fmt.Errorf("error looking up VM during hotplug attachment: %w", err)
 	}
 
-	for i, pvc := range pvcList {
-		name := fmt.Sprintf("hotplug-%d", i)
-		volume := &kubevirtv1.AddVolumeOptions{
-			Name: name,
-			Disk: &kubevirtv1.Disk{
-				DiskDevice: kubevirtv1.DiskDevice{
-					Disk: &kubevirtv1.DiskTarget{
-						Bus: "scsi",
-					},
-				},
-			},
-			VolumeSource: &kubevirtv1.HotplugVolumeSource{
-				PersistentVolumeClaim: &kubevirtv1.PersistentVolumeClaimVolumeSource{
-					PersistentVolumeClaimVolumeSource: corev1.PersistentVolumeClaimVolumeSource{
-						ClaimName: pvc.Name,
-					},
-				},
-			},
-		}
+	var pvcNames []string
+	for _, disk := range disks {
+		volume := newAddVolumeOptions(disk.name, disk.pvc.Name, disk.bus)
 
 		// add volume
 		if err := v.clients.kubevirtClient.VirtualMachine(vmObj.Namespace).AddVolume(ctx, vmObj.Name, volume); err != nil {
-			return fmt.Errorf("error attempting to hot plug disks: %w", err)
+			return fmt.Errorf("error attempting to hot plug disk %s using bus %s: %w", disk.name, disk.bus, err)
 		}
+		pvcNames = append(pvcNames, disk.pvc.Name)
 	}
 
 	// wait until VMI reflects hot plug volumeStatus
-	// need to create a VirtualMachineInstance object as volumestatus is part of VirtualMachineInstance object
+	if err := v.waitForHotplugVolumes(ctx, vmObj.Name, pvcNames); err != nil {
+		return err
+	}
+
+	// hot plugged disks need to be attached on the target node during migration, which
+	// is only possible with ReadWriteMany volumes
+	if reason := v.notApplicable([]string{api.FeatureRWX}); reason != "" {
+		logrus.Infof("skipping migration of vm %s with hot plugged volumes: %s", v.vmName, reason)
+	} else if err := v.migrateVMWithVolumes(ctx); err != nil {
+		return err
+	}
+
+	return v.unplugVolumes(ctx, disks)
+}
+
+// migrateVMWithVolumes live migrates the vm, and waits until all volumes including
+// hot plugged disks are ready on the target node
+func (v *ValidationRun) migrateVMWithVolumes(ctx context.Context) error {
+	vmiObj := &kubevirtv1.VirtualMachineInstance{}
+	if err := v.clients.runtimeClient.Get(ctx, types.NamespacedName{Name: v.vmName, Namespace: v.Configuration.Namespace}, vmiObj); err != nil {
+		return fmt.Errorf("error looking up vmi %s: %w", v.vmName, err)
+	}
+	sourceNode := vmiObj.Status.NodeName
+
+	if err := v.migrateVM(ctx, v.newVMMigration()); err != nil {
+		return err
+	}
+
+	verifyVMIVolumesMigrated := func(obj client.Object) (bool, error) {
+		vmiObj, ok := obj.(*kubevirtv1.VirtualMachineInstance)
+		if !ok {
+			return false, fmt.Errorf("error asserting object %v to vmi", client.ObjectKeyFromObject(obj))
+		}
+		if vmiObj.Status.NodeName == sourceNode || vmiObj.Status.Phase != kubevirtv1.Running {
+			return false, nil
+		}
+		return vmiVolumesReady(vmiObj), nil
+	}
+	return v.waitUntilObjectIsReady(ctx, vmiObj, verifyVMIVolumesMigrated)
+}
+
+// unplugVolumes removes the hot plugged disks, and waits until they are no longer reported
+// in the vmi volume status and the pods used to attach them to the node are removed
+func (v *ValidationRun) unplugVolumes(ctx context.Context, disks []hotplugDisk) error {
+	vmiObj := &kubevirtv1.VirtualMachineInstance{}
+	if err := v.clients.runtimeClient.Get(ctx, types.NamespacedName{Name: v.vmName, Namespace: v.Configuration.Namespace}, vmiObj); err != nil {
+		return fmt.Errorf("error looking up vmi %s: %w", v.vmName, err)
+	}
+
+	names := map[string]bool{}
+	for _, disk := range disks {
+		names[disk.name] = true
+	}
+
+	attachPods := map[string]bool{}
+	for _, status := range vmiObj.Status.VolumeStatus {
+		if names[status.Name] && status.HotplugVolume != nil && status.HotplugVolume.AttachPodName != "" {
+			attachPods[status.HotplugVolume.AttachPodName] = true
+		}
+	}
+
+	// harvester webhooks block pvc deletion if its hot plugged to a volume
+	// to avoid this we remove the hot plugged disks
+	for _, disk := range disks {
+		volume := &kubevirtv1.RemoveVolumeOptions{
+			Name: disk.name,
+		}
+
+		// remove volume
+		if err := v.clients.kubevirtClient.VirtualMachine(vmiObj.Namespace).RemoveVolume(ctx, vmiObj.Name, volume); err != nil {
+			return fmt.Errorf("error attempting to remove hot plug disk %s: %w", disk.name, err)
+		}
+	}
+
+	verifyVolumesRemoved := func(obj client.Object) (bool, error) {
+		vmiObj, ok := obj.(*kubevirtv1.VirtualMachineInstance)
+		if !ok {
+			return false, fmt.Errorf("error asserting object %v to vmi", client.ObjectKeyFromObject(obj))
+		}
+		for _, status := range vmiObj.Status.VolumeStatus {
+			if names[status.Name] {
+				return false, nil
+			}
+		}
+		return true, nil
+	}
+	if err := v.waitUntilObjectIsReady(ctx, vmiObj, verifyVolumesRemoved); err != nil {
+		return err
+	}
+
+	for podName := range attachPods {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      podName,
+				Namespace: vmiObj.Namespace,
+			},
+		}
+		if err := v.waitUntilObjectIsDeleted(ctx, pod); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (v *ValidationRun) planHotPlugVolume() []client.Object {
+	var objs []client.Object
+	for _, disk := range v.newHotplugDisks() {
+		objs = append(objs, disk.pvc)
+	}
+	return append(objs, v.newVMMigration())
+}
+
+// newHotplugDisks defines a block and a filesystem mode disk for every configured bus
+func (v *ValidationRun) newHotplugDisks() []hotplugDisk {
+	var disks []hotplugDisk
+	modes := map[corev1.PersistentVolumeMode]string{
+		corev1.PersistentVolumeBlock:      "block",
+		corev1.PersistentVolumeFilesystem: "fs",
+	}
+	for _, bus := range v.Configuration.Hotplug.Buses {
+		for _, mode := range []corev1.PersistentVolumeMode{corev1.PersistentVolumeBlock, corev1.PersistentVolumeFilesystem} {
+			disks = append(disks, hotplugDisk{
+				// disk names are used as serial, so they are kept short
+				name: strings.ToLower(fmt.Sprintf("hp-%s-%s", modes[mode], bus)),
+				bus:  kubevirtv1.DiskBus(bus),
+				pvc:  v.newHotplugPVC(mode),
+			})
+		}
+	}
+	return disks
+}
+
+// newAddVolumeOptions defines a hotplug disk for the pvc. the volume name is used as disk
+// serial, so the disk can be identified in the guest under /dev/disk/by-id
+func newAddVolumeOptions(name, pvcName string, bus kubevirtv1.DiskBus) *kubevirtv1.AddVolumeOptions {
+	return &kubevirtv1.AddVolumeOptions{
+		Name: name,
+		Disk: &kubevirtv1.Disk{
+			Serial: name,
+			DiskDevice: kubevirtv1.DiskDevice{
+				Disk: &kubevirtv1.DiskTarget{
+					Bus: bus,
+				},
+			},
+		},
+		VolumeSource: &kubevirtv1.HotplugVolumeSource{
+			PersistentVolumeClaim: &kubevirtv1.PersistentVolumeClaimVolumeSource{
+				PersistentVolumeClaimVolumeSource: corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: pvcName,
+				},
+			},
+		},
+	}
+}
+
+// waitForHotplugVolumes waits until the vmi reports the hot plugged pvcs as attached.
+// volume status is part of the VirtualMachineInstance object, which shares the name of the vm
+func (v *ValidationRun) waitForHotplugVolumes(ctx context.Context, vmName string, pvcNames []string) error {
 	vmiObj := &kubevirtv1.VirtualMachineInstance{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      vmObj.Name,
-			Namespace: vmObj.Namespace,
+			Name:      vmName,
+			Namespace: v.Configuration.Namespace,
 		},
 	}
 
@@ -105,38 +226,70 @@ func (v *ValidationRun) hotPlugVolume(ctx context.Context) error {
 		}
 
 		attachedCount := 0
-		for _, pvc := range pvcList {
+		for _, pvcName := range pvcNames {
 			for _, volumeStatus := range vmiObj.Status.VolumeStatus {
-				if volumeStatus.PersistentVolumeClaimInfo.ClaimName == pvc.Name && volumeStatus.Phase == kubevirtv1.HotplugVolumeAttachedToNode {
+				if volumeStatus.PersistentVolumeClaimInfo != nil && volumeStatus.PersistentVolumeClaimInfo.ClaimName == pvcName && volumeStatus.Phase == kubevirtv1.HotplugVolumeAttachedToNode {
 					attachedCount++
 				}
 			}
 		}
 
-		if len(pvcList) == attachedCount {
+		if len(pvcNames) == attachedCount {
 			return true, nil
 		}
 		return false, nil
 	}
 
-	// wait until VM is running
-	if err := v.waitUntilObjectIsReady(ctx, vmiObj, checkHotPlugStatus); err != nil {
-		return err
+	return v.waitUntilObjectIsReady(ctx, vmiObj, checkHotPlugStatus)
+}
+
+// newHotplugPVC defines a pvc which can be hot plugged to the validation vm
+func (v *ValidationRun) newHotplugPVC(volumeMode corev1.PersistentVolumeMode) *corev1.PersistentVolumeClaim {
+	return &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "hotplug-storage-validation-",
+			Namespace:    v.Configuration.Namespace,
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes:      []corev1.PersistentVolumeAccessMode{v.volumeAccessMode()},
+			StorageClassName: ptr.To(v.Configuration.StorageClass),
+			Resources: corev1.VolumeResourceRequirements{
+				Requests: map[corev1.ResourceName]resource.Quantity{
+					corev1.ResourceStorage: resource.MustParse(DefaultPVCSize),
+				},
+			},
+			VolumeMode: ptr.To(volumeMode),
+		},
 	}
+}
 
-	// harvester webhooks block pvc deletion if its hot plugged to a volume
-	// to avoid this we remove the hot plugged disks
-	for i := range pvcList {
-		name := fmt.Sprintf("hotplug-%d", i)
-		volume := &kubevirtv1.RemoveVolumeOptions{
-			Name: name,
-		}
+// hotplugAndUnplug hot plugs a new volume to the vm, unplugs it, and removes the volume
+// along with its pv so that repeated calls start from the same state
+func (v *ValidationRun) hotplugAndUnplug(ctx context.Context, name string) error {
+	disk := hotplugDisk{
+		name: name,
+		bus:  kubevirtv1.DiskBusSCSI,
+		pvc:  v.newHotplugPVC(corev1.PersistentVolumeBlock),
+	}
+	if err := v.clients.runtimeClient.Create(ctx, disk.pvc); err != nil {
+		return fmt.Errorf("error creating pvc: %w", err)
+	}
+	v.createdObjects = append(v.createdObjects, disk.pvc)
 
-		// remove volume
-		if err := v.clients.kubevirtClient.VirtualMachine(vmObj.Namespace).RemoveVolume(ctx, vmObj.Name, volume); err != nil {
-			return fmt.Errorf("error attempting to remove hot plug disks: %w", err)
-		}
+	if err := v.clients.kubevirtClient.VirtualMachine(v.Configuration.Namespace).AddVolume(ctx, v.vmName, newAddVolumeOptions(disk.name, disk.pvc.Name, disk.bus)); err != nil {
+		return fmt.Errorf("error attempting to hot plug disk %s: %w", disk.name, err)
 	}
 
-	return nil
+	if err := v.waitForHotplugVolumes(ctx, v.vmName, []string{disk.pvc.Name}); err != nil {
+		return err
+	}
+
+	if err := v.unplugVolumes(ctx, []hotplugDisk{disk}); err != nil {
+		return err
+	}
+
+	if err := v.clients.runtimeClient.Get(ctx, client.ObjectKeyFromObject(disk.pvc), disk.pvc); err != nil {
+		return fmt.Errorf("error looking up pvc %s: %w", disk.pvc.Name, err)
+	}
+	return v.deleteAndWait(ctx, disk.pvc, &corev1.PersistentVolume{ObjectMeta: metav1.ObjectMeta{Name: disk.pvc.Spec.VolumeName}})
 }
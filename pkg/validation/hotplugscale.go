@@ -0,0 +1,209 @@
+package validation
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	kubevirtv1 "kubevirt.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/harvester/storage-validator/pkg/api"
+)
+
+// hotPlugVolumeScale keeps hot plugging volumes to the validation vm until the configured
+// maximum is reached or a volume fails to attach, to identify the number of volumes which
+// can be attached to a single vm. reaching a limit is reported rather than failing the check,
+// while errors reaching the api fail it
+func (v *ValidationRun) hotPlugVolumeScale(ctx context.Context) error {
+	hotplug := v.Configuration.Hotplug
+	if hotplug.MaxVolumes <= 0 {
+		return skipCheck("hotplug scale check not enabled, set hotplug.maxVolumes to find the attachable volume limit")
+	}
+
+	result := &api.HotplugScaleResult{}
+	v.Report.HotplugScale = result
+
+	var disks []hotplugDisk
+	// disks are always unplugged, including a disk which failed to attach. the run may have
+	// timed out, so the unplug is given as long as a volume is given to attach
+	defer func() {
+		if len(disks) == 0 {
+			return
+		}
+		cleanupCtx, cancel := context.WithTimeout(context.Background(), time.Duration(hotplug.AttachTimeout)*time.Second)
+		defer cancel()
+		if err := v.unplugVolumes(cleanupCtx, disks); err != nil {
+			logrus.Errorf("error unplugging hotplug scale volumes: %v", err)
+		}
+	}()
+
+	vmClient := v.clients.kubevirtClient.VirtualMachine(v.Configuration.Namespace)
+	for i := 0; i < hotplug.MaxVolumes; i++ {
+		disk := hotplugDisk{
+			name: fmt.Sprintf("scale-%d", i),
+			bus:  kubevirtv1.DiskBusSCSI,
+			pvc:  v.newHotplugPVC(corev1.PersistentVolumeBlock),
+		}
+		if err := v.clients.runtimeClient.Create(ctx, disk.pvc); err != nil {
+			return fmt.Errorf("error creating pvc: %w", err)
+		}
+		v.createdObjects = append(v.createdObjects, disk.pvc)
+
+		start := time.Now()
+		if err := vmClient.AddVolume(ctx, v.vmName, newAddVolumeOptions(disk.name, disk.pvc.Name, disk.bus)); err != nil {
+			// kubevirt rejects volumes beyond its limits through validation, any other
+			// error is a failure to reach the api rather than a limit
+			if !apierrors.IsInvalid(err) && !apierrors.IsBadRequest(err) {
+				return fmt.Errorf("error attempting to hot plug disk %s to vm %s: %w", disk.name, v.vmName, err)
+			}
+			result.LimitSource = api.HotplugLimitKubeVirt
+			result.LimitInfo = err.Error()
+			break
+		}
+		disks = append(disks, disk)
+
+		attachCtx, cancel := context.WithTimeout(ctx, time.Duration(hotplug.AttachTimeout)*time.Second)
+		err := v.waitForHotplugVolumes(attachCtx, v.vmName, []string{disk.pvc.Name})
+		cancel()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			info, limited, limitErr := v.csiAttachLimitReached(ctx)
+			if limitErr != nil {
+				return fmt.Errorf("volume %s did not attach to vm %s after %d volumes were attached: %w", disk.name, v.vmName, len(result.Volumes), limitErr)
+			}
+			if limited {
+				result.LimitSource, result.LimitInfo = api.HotplugLimitCSIDriver, info
+				break
+			}
+			info, limitErr = v.nodeAttachLimitInfo(ctx, disk.name)
+			if limitErr != nil {
+				return fmt.Errorf("volume %s did not attach to vm %s after %d volumes were attached: %w", disk.name, v.vmName, len(result.Volumes), limitErr)
+			}
+			result.LimitSource, result.LimitInfo = api.HotplugLimitNode, info
+			break
+		}
+
+		attachResult := api.HotplugAttachResult{
+			Name:          disk.name,
+			AttachSeconds: time.Since(start).Round(time.Millisecond).Seconds(),
+		}
+		result.Volumes = append(result.Volumes, attachResult)
+		result.MaxAttached = len(result.Volumes)
+		logrus.Infof("hot plugged volume %d to vm %s in %.1fs", result.MaxAttached, v.vmName, attachResult.AttachSeconds)
+	}
+
+	if result.LimitSource != "" {
+		logrus.Warnf("hot plugged %d volumes to vm %s, limited by %s: %s", result.MaxAttached, v.vmName, result.LimitSource, result.LimitInfo)
+	}
+	return nil
+}
+
+// hotplugScaleTimeout returns the time added to the run timeout for the hotplug scale check,
+// which allows every volume up to the maximum the time given to attach
+func (v *ValidationRun) hotplugScaleTimeout() time.Duration {
+	hotplug := v.Configuration.Hotplug
+	if hotplug.MaxVolumes <= 0 {
+		return 0
+	}
+	return time.Duration(hotplug.MaxVolumes*hotplug.AttachTimeout) * time.Second
+}
+
+func (v *ValidationRun) planHotPlugVolumeScale() []client.Object {
+	var objs []client.Object
+	for i := 0; i < v.Configuration.Hotplug.MaxVolumes; i++ {
+		objs = append(objs, v.newHotplugPVC(corev1.PersistentVolumeBlock))
+	}
+	return objs
+}
+
+// csiAttachLimitReached checks whether the node running the vm has as many volumes of the
+// storage class driver attached as its CSINode allows, which explains a volume not attaching
+func (v *ValidationRun) csiAttachLimitReached(ctx context.Context) (string, bool, error) {
+	nodeName, err := v.vmiNodeName(ctx)
+	if err != nil {
+		return "", false, err
+	}
+
+	limit, attached, err := v.csiAttachLimit(ctx, nodeName)
+	if err != nil {
+		return "", false, err
+	}
+	if limit == 0 || attached < limit {
+		return "", false, nil
+	}
+	return fmt.Sprintf("node %s has %d volumes of driver %s attached, CSINode allocatable count is %d", nodeName, attached, v.storageClass.Provisioner, limit), true, nil
+}
+
+// nodeAttachLimitInfo explains a volume which did not attach while the node is below the csi
+// driver limit, using the volume status reported by kubevirt and the latest warning events of
+// the vmi and of the pod attaching the volume to the node
+func (v *ValidationRun) nodeAttachLimitInfo(ctx context.Context, diskName string) (string, error) {
+	vmiObj := &kubevirtv1.VirtualMachineInstance{}
+	if err := v.clients.runtimeClient.Get(ctx, types.NamespacedName{Name: v.vmName, Namespace: v.Configuration.Namespace}, vmiObj); err != nil {
+		return "", fmt.Errorf("error looking up vmi %s: %w", v.vmName, err)
+	}
+
+	info := []string{fmt.Sprintf("volume %s on node %s is not ready", diskName, vmiObj.Status.NodeName)}
+	objs := []client.Object{vmiObj}
+	for _, status := range vmiObj.Status.VolumeStatus {
+		if status.Name != diskName {
+			continue
+		}
+		info[0] = fmt.Sprintf("volume %s on node %s is %s", diskName, vmiObj.Status.NodeName, status.Phase)
+		if status.Message != "" {
+			info = append(info, status.Message)
+		}
+		if status.HotplugVolume != nil && status.HotplugVolume.AttachPodName != "" {
+			objs = append(objs, v.fetchRelated(ctx, &corev1.Pod{}, vmiObj.Namespace, status.HotplugVolume.AttachPodName))
+		}
+	}
+
+	for _, obj := range objs {
+		events, err := v.warningEvents(ctx, obj)
+		if err != nil {
+			return "", err
+		}
+		if len(events) > 0 {
+			info = append(info, fmt.Sprintf("%s %s: %s: %s", objectKind(obj), obj.GetName(), events[0].Reason, events[0].Message))
+		}
+	}
+	return strings.Join(info, ", "), nil
+}
+
+// csiAttachLimit returns the allocatable volume count of the storage class driver on the node,
+// and the number of volumes of the driver attached to the node
+func (v *ValidationRun) csiAttachLimit(ctx context.Context, nodeName string) (int, int, error) {
+	csiNode := &storagev1.CSINode{}
+	if err := v.clients.runtimeClient.Get(ctx, types.NamespacedName{Name: nodeName}, csiNode); err != nil {
+		return 0, 0, fmt.Errorf("error looking up csinode %s: %w", nodeName, err)
+	}
+
+	var limit int
+	for _, driver := range csiNode.Spec.Drivers {
+		if driver.Name == v.storageClass.Provisioner && driver.Allocatable != nil && driver.Allocatable.Count != nil {
+			limit = int(*driver.Allocatable.Count)
+		}
+	}
+
+	attachmentList := &storagev1.VolumeAttachmentList{}
+	if err := v.clients.runtimeClient.List(ctx, attachmentList); err != nil {
+		return limit, 0, fmt.Errorf("error listing volumeattachments: %w", err)
+	}
+
+	var attached int
+	for _, attachment := range attachmentList.Items {
+		if attachment.Spec.NodeName == nodeName && attachment.Spec.Attacher == v.storageClass.Provisioner && attachment.Status.Attached {
+			attached++
+		}
+	}
+	return limit, attached, nil
+}
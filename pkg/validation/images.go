@@ -0,0 +1,116 @@
+package validation
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	virtControllerLabelKey   = "kubevirt.io"
+	virtControllerLabelValue = "virt-controller"
+	launcherImageArg         = "--launcher-image"
+	cdiDeploymentName        = "cdi-deployment"
+)
+
+// cdiImageEnvVars identify the images used by cdi to populate datavolumes
+var cdiImageEnvVars = []string{"IMPORTER_IMAGE", "CLONER_IMAGE", "UPLOADSERVER_IMAGE"}
+
+// listImages writes the container images needed by the validation run. images deployed
+// by the validator itself are always listed, while images used by the platform to run
+// vms and populate volumes are looked up from the cluster when it is reachable
+func (v *ValidationRun) listImages(out io.Writer) error {
+	v.applyWorkloadDefaults()
+	images := v.workloadImages()
+
+	if err := v.setupClients(); err != nil {
+		logrus.Warnf("unable to lookup platform images from cluster: %v", err)
+	} else {
+		platformImages, err := v.platformImages(v.ctx)
+		if err != nil {
+			logrus.Warnf("unable to lookup platform images from cluster: %v", err)
+		}
+		images = append(images, platformImages...)
+	}
+
+	for _, image := range dedupeImages(images) {
+		fmt.Fprintln(out, image)
+	}
+	return nil
+}
+
+// workloadImages returns images used by pods created by the validator
+func (v *ValidationRun) workloadImages() []string {
+	images := []string{v.Configuration.Workload.Image}
+	if v.Configuration.Benchmark.Enabled && v.Configuration.Benchmark.Image != "" {
+		images = append(images, v.Configuration.Benchmark.Image)
+	}
+	return images
+}
+
+// platformImages returns images used by kubevirt and cdi for objects created by the validator,
+// such as virt-launcher pods for vms and hotplug volumes, and importer pods for datavolumes
+func (v *ValidationRun) platformImages(ctx context.Context) ([]string, error) {
+	var images []string
+	deploymentList := &appsv1.DeploymentList{}
+	if err := v.clients.runtimeClient.List(ctx, deploymentList, client.MatchingLabels{virtControllerLabelKey: virtControllerLabelValue}); err != nil {
+		return nil, fmt.Errorf("error listing virt-controller deployments: %w", err)
+	}
+
+	for _, deployment := range deploymentList.Items {
+		for _, container := range deployment.Spec.Template.Spec.Containers {
+			images = append(images, argValue(container.Args, launcherImageArg))
+		}
+	}
+
+	if err := v.clients.runtimeClient.List(ctx, deploymentList, client.MatchingFields{"metadata.name": cdiDeploymentName}); err != nil {
+		return images, fmt.Errorf("error listing cdi deployments: %w", err)
+	}
+
+	for _, deployment := range deploymentList.Items {
+		for _, container := range deployment.Spec.Template.Spec.Containers {
+			for _, env := range container.Env {
+				for _, name := range cdiImageEnvVars {
+					if env.Name == name {
+						images = append(images, env.Value)
+					}
+				}
+			}
+		}
+	}
+	return images, nil
+}
+
+// argValue returns the value of a flag from container args, supporting
+// both "--flag value" and "--flag=value" forms
+func argValue(args []string, flag string) string {
+	for i, arg := range args {
+		if arg == flag && i+1 < len(args) {
+			return args[i+1]
+		}
+		if value, ok := strings.CutPrefix(arg, flag+"="); ok {
+			return value
+		}
+	}
+	return ""
+}
+
+func dedupeImages(images []string) []string {
+	seen := map[string]bool{}
+	var result []string
+	for _, image := range images {
+		if image == "" || seen[image] {
+			continue
+		}
+		seen[image] = true
+		result = append(result, image)
+	}
+	sort.Strings(result)
+	return result
+}
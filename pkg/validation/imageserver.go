@@ -0,0 +1,156 @@
+package validation
+
+import (
+	"context"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// serveImageFile verifies the optional checksum of the configured image file and serves
+// it over a temporary http endpoint, which is used as the ImageURL for vmimage creation.
+// the returned func stops the server once the validation run has completed
+func (v *ValidationRun) serveImageFile() (func(), error) {
+	imageFile := v.Configuration.ImageFile
+	info, err := os.Stat(imageFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading imageFile %s: %w", imageFile, err)
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("imageFile %s is a directory", imageFile)
+	}
+
+	if v.Configuration.ImageChecksum != "" {
+		logrus.Infof("verifying checksum of imageFile %s", imageFile)
+		if err := verifyFileChecksum(imageFile, v.Configuration.ImageChecksum); err != nil {
+			return nil, err
+		}
+	}
+
+	listener, err := net.Listen("tcp", v.Configuration.ImageServer.ListenAddress)
+	if err != nil {
+		return nil, fmt.Errorf("error starting image server on %s: %w", v.Configuration.ImageServer.ListenAddress, err)
+	}
+
+	port := listener.Addr().(*net.TCPAddr).Port
+	v.Configuration.ImageURL, err = v.imageServerURL(strconv.Itoa(port))
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	imagePath := imageServerPath(imageFile)
+	mux := http.NewServeMux()
+	mux.HandleFunc(imagePath, func(w http.ResponseWriter, r *http.Request) {
+		logrus.Debugf("serving imageFile %s to %s", imageFile, r.RemoteAddr)
+		http.ServeFile(w, r, imageFile)
+	})
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 30 * time.Second,
+	}
+
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logrus.Errorf("error serving imageFile %s: %v", imageFile, err)
+		}
+	}()
+	logrus.Infof("serving imageFile %s at %s", imageFile, v.Configuration.ImageURL)
+
+	stop := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			logrus.Errorf("error stopping image server: %v", err)
+		}
+	}
+	return stop, nil
+}
+
+// planImageFileURL sets the ImageURL to the address the image file would be served at, without
+// starting the image server or reading the image file. a random listen port is rendered
+// with the same placeholder as generated names
+func (v *ValidationRun) planImageFileURL() error {
+	port := generatedNameSuffix
+	if _, listenPort, err := net.SplitHostPort(v.Configuration.ImageServer.ListenAddress); err == nil && listenPort != "" && listenPort != "0" {
+		port = listenPort
+	}
+
+	imageURL, err := v.imageServerURL(port)
+	if err != nil {
+		return err
+	}
+	v.Configuration.ImageURL = imageURL
+	return nil
+}
+
+// imageServerURL returns the url the image file is served at on the port, using the
+// advertise address or the local address used to reach the apiserver
+func (v *ValidationRun) imageServerURL(port string) (string, error) {
+	advertiseAddress := v.Configuration.ImageServer.AdvertiseAddress
+	if advertiseAddress == "" {
+		var err error
+		advertiseAddress, err = v.localAddressForCluster()
+		if err != nil {
+			return "", fmt.Errorf("error identifying address to advertise image server, set imageServer.advertiseAddress: %w", err)
+		}
+	}
+	return fmt.Sprintf("http://%s%s", net.JoinHostPort(advertiseAddress, port), imageServerPath(v.Configuration.ImageFile)), nil
+}
+
+func imageServerPath(imageFile string) string {
+	return "/" + url.PathEscape(filepath.Base(imageFile))
+}
+
+// localAddressForCluster identifies the local ip used to reach the apiserver, which is
+// assumed to be reachable from cluster nodes. no packets are sent as udp is connectionless
+func (v *ValidationRun) localAddressForCluster() (string, error) {
+	apiURL, err := url.Parse(v.cfg.Host)
+	if err != nil {
+		return "", fmt.Errorf("error parsing apiserver address %s: %w", v.cfg.Host, err)
+	}
+
+	port := apiURL.Port()
+	if port == "" {
+		port = "443"
+	}
+
+	conn, err := net.Dial("udp", net.JoinHostPort(apiURL.Hostname(), port))
+	if err != nil {
+		return "", fmt.Errorf("error identifying route to apiserver %s: %w", apiURL.Host, err)
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP.String(), nil
+}
+
+// verifyFileChecksum compares the sha512 checksum of a file with the expected value
+func verifyFileChecksum(path, expected string) error {
+	f, err := os.Open(filepath.Clean(path)) // #nosec G304 -- path is provided through the configuration file
+	if err != nil {
+		return fmt.Errorf("error opening %s: %w", path, err)
+	}
+	defer f.Close()
+
+	hash := sha512.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return fmt.Errorf("error computing checksum of %s: %w", path, err)
+	}
+
+	actual := hex.EncodeToString(hash.Sum(nil))
+	if !strings.EqualFold(actual, expected) {
+		return fmt.Errorf("checksum mismatch for %s, expected sha512 %s, got %s", path, expected, actual)
+	}
+	return nil
+}
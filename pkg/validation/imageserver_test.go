@@ -0,0 +1,37 @@
+package validation
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/harvester/storage-validator/pkg/api"
+)
+
+func Test_VerifyFileChecksum(t *testing.T) {
+	assert := require.New(t)
+	path := filepath.Join(t.TempDir(), "image.raw")
+	contents := []byte("storage-validator")
+	assert.NoError(os.WriteFile(path, contents, 0600))
+
+	sum := sha512.Sum512(contents)
+	assert.NoError(verifyFileChecksum(path, hex.EncodeToString(sum[:])))
+	assert.Error(verifyFileChecksum(path, "invalid"))
+}
+
+func Test_PlanImageFileURL(t *testing.T) {
+	assert := require.New(t)
+	v := &ValidationRun{Configuration: &api.Configuration{ImageFile: "/images/leap 15.6.qcow2"}}
+	v.Configuration.ImageServer.AdvertiseAddress = "10.0.0.10"
+
+	assert.NoError(v.planImageFileURL())
+	assert.Equal("http://10.0.0.10:xxxxx/leap%2015.6.qcow2", v.Configuration.ImageURL)
+
+	v.Configuration.ImageServer.ListenAddress = ":8080"
+	assert.NoError(v.planImageFileURL())
+	assert.Equal("http://10.0.0.10:8080/leap%2015.6.qcow2", v.Configuration.ImageURL)
+}
@@ -0,0 +1,323 @@
+package validation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	harvesterv1beta1 "github.com/harvester/harvester/pkg/apis/harvesterhci.io/v1beta1"
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+	kubevirtv1 "kubevirt.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// rancherClusterProxyPath is present in kubeconfigs downloaded from the harvester ui,
+	// which point to the cluster proxy served on the same endpoint as the harvester api
+	rancherClusterProxyPath = "/k8s/clusters/"
+	imageUploadPath         = "/v1/harvester/harvesterhci.io.virtualmachineimages"
+	imageUploadFormField    = "chunk"
+	imageUploadRetryDelay   = 10 * time.Second
+)
+
+// createVMImageFromVolume exports the boot volume of the validation vm to a vmimage. the vm
+// is stopped during the export, so the guest is not writing to the volume being exported,
+// and started again for subsequent checks
+func (v *ValidationRun) createVMImageFromVolume(ctx context.Context) error {
+	if err := v.stopVM(ctx); err != nil {
+		return err
+	}
+
+	vmImage := v.newVMImageFromVolume()
+	importErr := v.importVMImage(ctx, vmImage)
+	if err := v.startVM(ctx); err != nil {
+		return errors.Join(importErr, err)
+	}
+	if importErr != nil {
+		return importErr
+	}
+	return v.bootAndRemoveVM(ctx, vmImage.Name)
+}
+
+// createVMImageFromUpload uploads the image to the harvester api. ImageFile is uploaded
+// when specified, else the contents of ImageURL are streamed through the validator
+func (v *ValidationRun) createVMImageFromUpload(ctx context.Context) error {
+	harvesterURL := v.harvesterAPIURL()
+	if harvesterURL == "" {
+		return skipCheck("harvester api url cannot be derived from kubeconfig, specify imageSources.harvesterURL to validate image uploads")
+	}
+	httpClient, err := v.harvesterAPIClient(harvesterURL)
+	if err != nil {
+		return err
+	}
+
+	vmImage := v.newVMImageFromUpload()
+	if err := v.clients.runtimeClient.Create(ctx, vmImage); err != nil {
+		return fmt.Errorf("error creating vmimage: %w", err)
+	}
+	v.createdObjects = append(v.createdObjects, vmImage)
+
+	if err := v.uploadImage(ctx, httpClient, harvesterURL, vmImage); err != nil {
+		return err
+	}
+
+	if err := v.waitUntilObjectIsReady(ctx, vmImage, verifyVMImageImported); err != nil {
+		return err
+	}
+	return v.bootAndRemoveVM(ctx, vmImage.Name)
+}
+
+// createVMImageFromClone clones the vmimage created earlier into an encrypted vmimage, as
+// harvester supports cloning images only to encrypt or decrypt them
+func (v *ValidationRun) createVMImageFromClone(ctx context.Context) error {
+	if v.Configuration.ImageSources.CloneStorageClass == "" {
+		return skipCheck("no imageSources.cloneStorageClass specified, an encrypted storage class is needed to validate image cloning")
+	}
+
+	vmImage := v.newVMImageFromClone()
+	if err := v.importVMImage(ctx, vmImage); err != nil {
+		return err
+	}
+	return v.bootAndRemoveVM(ctx, vmImage.Name)
+}
+
+func (v *ValidationRun) planCreateVMImageFromVolume() []client.Object {
+	vmImage := v.newVMImageFromVolume()
+	return append([]client.Object{vmImage}, v.planBootVMFromImage(plannedName(vmImage))...)
+}
+
+func (v *ValidationRun) planCreateVMImageFromUpload() []client.Object {
+	vmImage := v.newVMImageFromUpload()
+	return append([]client.Object{vmImage}, v.planBootVMFromImage(plannedName(vmImage))...)
+}
+
+func (v *ValidationRun) planCreateVMImageFromClone() []client.Object {
+	if v.Configuration.ImageSources.CloneStorageClass == "" {
+		return nil
+	}
+	vmImage := v.newVMImageFromClone()
+	return append([]client.Object{vmImage}, v.planBootVMFromImage(plannedName(vmImage))...)
+}
+
+// importVMImage submits the vmimage and waits until it is imported
+func (v *ValidationRun) importVMImage(ctx context.Context, vmImage *harvesterv1beta1.VirtualMachineImage) error {
+	if err := v.clients.runtimeClient.Create(ctx, vmImage); err != nil {
+		return fmt.Errorf("error creating vmimage: %w", err)
+	}
+	v.createdObjects = append(v.createdObjects, vmImage)
+
+	return v.waitUntilObjectIsReady(ctx, vmImage, verifyVMImageImported)
+}
+
+// bootAndRemoveVM ensures a vm can boot from the vmimage, and removes the vm once running
+// to free up resources for subsequent checks, waiting until its vmi is gone
+func (v *ValidationRun) bootAndRemoveVM(ctx context.Context, imageName string) error {
+	vmObj, _, err := v.bootVMFromImage(ctx, imageName)
+	if err != nil {
+		return err
+	}
+
+	vmi := &kubevirtv1.VirtualMachineInstance{ObjectMeta: metav1.ObjectMeta{Name: vmObj.Name, Namespace: vmObj.Namespace}}
+	return v.deleteAndWait(ctx, vmObj, vmi)
+}
+
+func (v *ValidationRun) newVMImageFromVolume() *harvesterv1beta1.VirtualMachineImage {
+	vmImage := v.newVMImage()
+	vmImage.GenerateName = "vmimage-export-storage-validation-"
+	vmImage.Spec.DisplayName = "storage-validation-export-image"
+	vmImage.Spec.SourceType = harvesterv1beta1.VirtualMachineImageSourceTypeExportVolume
+	vmImage.Spec.URL = ""
+	vmImage.Spec.Checksum = ""
+	vmImage.Spec.PVCName = v.bootPVCName
+	vmImage.Spec.PVCNamespace = v.Configuration.Namespace
+	return vmImage
+}
+
+func (v *ValidationRun) newVMImageFromUpload() *harvesterv1beta1.VirtualMachineImage {
+	vmImage := v.newVMImage()
+	vmImage.GenerateName = "vmimage-upload-storage-validation-"
+	vmImage.Spec.DisplayName = "storage-validation-upload-image"
+	vmImage.Spec.SourceType = harvesterv1beta1.VirtualMachineImageSourceTypeUpload
+	vmImage.Spec.URL = ""
+	return vmImage
+}
+
+func (v *ValidationRun) newVMImageFromClone() *harvesterv1beta1.VirtualMachineImage {
+	vmImage := v.newVMImage()
+	vmImage.GenerateName = "vmimage-clone-storage-validation-"
+	vmImage.Spec.DisplayName = "storage-validation-clone-image"
+	vmImage.Spec.SourceType = harvesterv1beta1.VirtualMachineImageSourceTypeClone
+	vmImage.Spec.URL = ""
+	vmImage.Spec.Checksum = ""
+	vmImage.Spec.TargetStorageClassName = v.Configuration.ImageSources.CloneStorageClass
+	vmImage.Spec.SecurityParameters = &harvesterv1beta1.VirtualMachineImageSecurityParameters{
+		CryptoOperation:      harvesterv1beta1.VirtualMachineImageCryptoOperationTypeEncrypt,
+		SourceImageName:      v.vmImageName,
+		SourceImageNamespace: v.Configuration.Namespace,
+	}
+	return vmImage
+}
+
+// harvesterAPIURL returns the configured harvester api url, or derives one from the
+// kubeconfig when it points to the cluster proxy on the harvester vip
+func (v *ValidationRun) harvesterAPIURL() string {
+	if v.Configuration.ImageSources.HarvesterURL != "" {
+		return strings.TrimSuffix(v.Configuration.ImageSources.HarvesterURL, "/")
+	}
+
+	if idx := strings.Index(v.cfg.Host, rancherClusterProxyPath); idx > 0 {
+		return v.cfg.Host[:idx]
+	}
+	return ""
+}
+
+// harvesterAPIClient returns the http client used to upload images to the harvester api. the
+// kubeconfig credentials are only used when the api is served on the host of the kubeconfig,
+// else the configured harvester token is used, so credentials are not sent to another host
+func (v *ValidationRun) harvesterAPIClient(harvesterURL string) (*http.Client, error) {
+	cfg := v.cfg
+	if !sameOrigin(harvesterURL, v.cfg.Host) {
+		if v.Configuration.ImageSources.HarvesterToken == "" {
+			return nil, skipCheck("imageSources.harvesterURL %s is not served on the kubeconfig host, specify imageSources.harvesterToken to validate image uploads", harvesterURL)
+		}
+		cfg = rest.AnonymousClientConfig(v.cfg)
+		cfg.BearerToken = v.Configuration.ImageSources.HarvesterToken
+	}
+
+	httpClient, err := rest.HTTPClientFor(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("error generating http client for harvester api: %w", err)
+	}
+	return httpClient, nil
+}
+
+// sameOrigin reports whether both urls have the same scheme and host, urls without a
+// scheme are considered to use https as is the case for kubeconfig hosts
+func sameOrigin(a, b string) bool {
+	origin := func(raw string) (string, bool) {
+		if !strings.Contains(raw, "://") {
+			raw = "https://" + raw
+		}
+		u, err := url.Parse(raw)
+		if err != nil || u.Host == "" {
+			return "", false
+		}
+		return strings.ToLower(u.Scheme + "://" + u.Host), true
+	}
+	originA, okA := origin(a)
+	originB, okB := origin(b)
+	return okA && okB && originA == originB
+}
+
+// uploadImage streams the image to the harvester upload api, retrying while the
+// backend for the upload is still being prepared
+func (v *ValidationRun) uploadImage(ctx context.Context, httpClient *http.Client, harvesterURL string, vmImage *harvesterv1beta1.VirtualMachineImage) error {
+	var err error
+	for i := 0; i < maxRetryCount; i++ {
+		var retry bool
+		retry, err = v.uploadImageOnce(ctx, httpClient, harvesterURL, vmImage)
+		if err == nil || !retry {
+			return err
+		}
+
+		logrus.Warnf("retrying upload of vmimage %s in %s: %v", vmImage.Name, imageUploadRetryDelay, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(imageUploadRetryDelay):
+		}
+	}
+	return err
+}
+
+// uploadImageOnce performs a single upload attempt, and reports if the attempt can be retried
+func (v *ValidationRun) uploadImageOnce(ctx context.Context, httpClient *http.Client, harvesterURL string, vmImage *harvesterv1beta1.VirtualMachineImage) (bool, error) {
+	source, size, fileName, err := v.openImageSource(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer source.Close()
+
+	body, writer := io.Pipe()
+	form := multipart.NewWriter(writer)
+	go func() {
+		part, err := form.CreateFormFile(imageUploadFormField, fileName)
+		if err == nil {
+			_, err = io.Copy(part, source)
+		}
+		if err == nil {
+			err = form.Close()
+		}
+		writer.CloseWithError(err)
+	}()
+
+	uploadURL := fmt.Sprintf("%s%s/%s/%s?action=upload&size=%d", harvesterURL, imageUploadPath, vmImage.Namespace, vmImage.Name, size)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, uploadURL, body)
+	if err != nil {
+		return false, fmt.Errorf("error generating upload request: %w", err)
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+
+	logrus.Infof("uploading %s (%d bytes) to vmimage %s", fileName, size, vmImage.Name)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, fmt.Errorf("error uploading image: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return resp.StatusCode >= http.StatusInternalServerError, fmt.Errorf("error uploading image, received %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return false, nil
+}
+
+// openImageSource opens ImageFile when specified, else downloads ImageURL
+func (v *ValidationRun) openImageSource(ctx context.Context) (io.ReadCloser, int64, string, error) {
+	if imageFile := v.Configuration.ImageFile; imageFile != "" {
+		f, err := os.Open(filepath.Clean(imageFile)) // #nosec G304 -- path is provided through the configuration file
+		if err != nil {
+			return nil, 0, "", fmt.Errorf("error opening imageFile %s: %w", imageFile, err)
+		}
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, 0, "", fmt.Errorf("error reading imageFile %s: %w", imageFile, err)
+		}
+		return f, info.Size(), filepath.Base(imageFile), nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.Configuration.ImageURL, nil)
+	if err != nil {
+		return nil, 0, "", fmt.Errorf("error generating request for imageURL: %w", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, 0, "", fmt.Errorf("error downloading imageURL %s: %w", v.Configuration.ImageURL, err)
+	}
+
+	if resp.StatusCode != http.StatusOK || resp.ContentLength <= 0 {
+		resp.Body.Close()
+		return nil, 0, "", fmt.Errorf("error downloading imageURL %s, received %s with content length %d", v.Configuration.ImageURL, resp.Status, resp.ContentLength)
+	}
+
+	fileName := "image"
+	if parsed, err := url.Parse(v.Configuration.ImageURL); err == nil {
+		if base := path.Base(parsed.Path); base != "/" && base != "." {
+			fileName = base
+		}
+	}
+	return resp.Body, resp.ContentLength, fileName, nil
+}
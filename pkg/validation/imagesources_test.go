@@ -0,0 +1,17 @@
+package validation
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_SameOrigin(t *testing.T) {
+	assert := require.New(t)
+	assert.True(sameOrigin("https://192.168.1.10", "https://192.168.1.10/k8s/clusters/local"))
+	assert.True(sameOrigin("https://Harvester.example.com/", "harvester.example.com"))
+	assert.False(sameOrigin("https://192.168.1.10:8443", "https://192.168.1.10"))
+	assert.False(sameOrigin("http://192.168.1.10", "https://192.168.1.10"))
+	assert.False(sameOrigin("https://attacker.example.com", "https://192.168.1.10:6443"))
+	assert.False(sameOrigin("", "https://192.168.1.10"))
+}
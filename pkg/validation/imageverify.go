@@ -0,0 +1,208 @@
+package validation
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	harvesterv1beta1 "github.com/harvester/harvester/pkg/apis/harvesterhci.io/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	ImageFormatQcow2   = "qcow2"
+	ImageFormatRaw     = "raw"
+	ImageFormatUnknown = "unknown"
+
+	// imageHeaderSize is enough to read the qcow2 header fields needed for verification
+	imageHeaderSize = 512
+)
+
+var (
+	qcow2Magic = []byte{'Q', 'F', 'I', 0xfb}
+	// mbrSignature ends the first sector of raw disk images with an mbr or a gpt protective mbr
+	mbrSignature = []byte{0x55, 0xaa}
+	// compressionMagic identifies compressed images, which are decompressed during import
+	compressionMagic = map[string][]byte{
+		"gzip":  {0x1f, 0x8b},
+		"xz":    {0xfd, '7', 'z', 'X', 'Z', 0x00},
+		"zstd":  {0x28, 0xb5, 0x2f, 0xfd},
+		"bzip2": {'B', 'Z', 'h'},
+	}
+)
+
+// sourceImageInfo describes the image used as source for the vmimage
+type sourceImageInfo struct {
+	format      string
+	size        int64 // size of the image as imported, 0 if unknown
+	virtualSize int64 // size of the disk presented by the image, 0 if unknown
+}
+
+// verifyVMImage ensures the imported vmimage matches the source image, to catch
+// truncated downloads or images which have been silently converted during import
+func (v *ValidationRun) verifyVMImage(ctx context.Context) error {
+	vmImage := &harvesterv1beta1.VirtualMachineImage{}
+	if err := v.clients.runtimeClient.Get(ctx, types.NamespacedName{Name: v.vmImageName, Namespace: v.Configuration.Namespace}, vmImage); err != nil {
+		return fmt.Errorf("error looking up vmimage %s: %w", v.vmImageName, err)
+	}
+
+	source, err := v.inspectSourceImage(ctx)
+	if err != nil {
+		return err
+	}
+
+	expected := v.Configuration.ImageVerification
+	var errs []error
+	if expected.Format != "" && !strings.EqualFold(expected.Format, source.format) {
+		errs = append(errs, fmt.Errorf("expected source image format %s, detected %s", expected.Format, source.format))
+	}
+
+	if vmImage.Status.Size <= 0 {
+		errs = append(errs, fmt.Errorf("vmimage %s reports no size", vmImage.Name))
+	}
+	expectedSize := expected.Size
+	// images using the cdi backend are converted to raw, so their size does not match the source
+	if expectedSize == 0 && vmImage.Spec.Backend != harvesterv1beta1.VMIBackendCDI {
+		expectedSize = source.size
+	}
+	if expectedSize > 0 && vmImage.Status.Size != expectedSize {
+		errs = append(errs, fmt.Errorf("expected vmimage size %d, vmimage %s reports %d", expectedSize, vmImage.Name, vmImage.Status.Size))
+	}
+
+	expectedVirtualSize := expected.VirtualSize
+	if expectedVirtualSize == 0 {
+		expectedVirtualSize = source.virtualSize
+	}
+	if expectedVirtualSize > 0 && vmImage.Status.VirtualSize != expectedVirtualSize {
+		errs = append(errs, fmt.Errorf("expected vmimage virtual size %d, vmimage %s reports %d", expectedVirtualSize, vmImage.Name, vmImage.Status.VirtualSize))
+	}
+
+	// images using the cdi backend are stored in a golden pvc with the same name,
+	// which needs to be large enough to hold the disk presented by the image
+	if vmImage.Spec.Backend == harvesterv1beta1.VMIBackendCDI && vmImage.Status.VirtualSize > 0 {
+		pvc := &corev1.PersistentVolumeClaim{}
+		if err := v.clients.runtimeClient.Get(ctx, types.NamespacedName{Name: vmImage.Name, Namespace: vmImage.Namespace}, pvc); err != nil {
+			return fmt.Errorf("error looking up golden pvc for vmimage %s: %w", vmImage.Name, err)
+		}
+		capacity := pvc.Status.Capacity[corev1.ResourceStorage]
+		if capacity.Cmp(*resource.NewQuantity(vmImage.Status.VirtualSize, resource.BinarySI)) < 0 {
+			errs = append(errs, fmt.Errorf("golden pvc %s capacity %s is smaller than vmimage virtual size %d", pvc.Name, capacity.String(), vmImage.Status.VirtualSize))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// inspectSourceImage reads the header of ImageFile or ImageURL to identify the format and sizes of the image
+func (v *ValidationRun) inspectSourceImage(ctx context.Context) (sourceImageInfo, error) {
+	var header []byte
+	var size int64
+	if imageFile := v.Configuration.ImageFile; imageFile != "" {
+		f, err := os.Open(filepath.Clean(imageFile)) // #nosec G304 -- path is provided through the configuration file
+		if err != nil {
+			return sourceImageInfo{}, fmt.Errorf("error opening imageFile %s: %w", imageFile, err)
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			return sourceImageInfo{}, fmt.Errorf("error reading imageFile %s: %w", imageFile, err)
+		}
+		size = info.Size()
+		header, err = readHeader(f)
+		if err != nil {
+			return sourceImageInfo{}, fmt.Errorf("error reading header of imageFile %s: %w", imageFile, err)
+		}
+	} else {
+		var err error
+		header, size, err = fetchImageHeader(ctx, v.Configuration.ImageURL)
+		if err != nil {
+			return sourceImageInfo{}, err
+		}
+	}
+
+	return detectImageFormat(header, size), nil
+}
+
+// fetchImageHeader requests the first bytes of the image, along with the size of the image
+// from the Content-Range header, or the Content-Length if the server ignores the range
+func fetchImageHeader(ctx context.Context, imageURL string) ([]byte, int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, imageURL, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error generating request for imageURL: %w", err)
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=0-%d", imageHeaderSize-1))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error fetching header of imageURL %s: %w", imageURL, err)
+	}
+	defer resp.Body.Close()
+
+	var size int64
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		// Content-Range is of the form "bytes 0-511/1073741824"
+		if idx := strings.LastIndex(resp.Header.Get("Content-Range"), "/"); idx >= 0 {
+			size, _ = strconv.ParseInt(resp.Header.Get("Content-Range")[idx+1:], 10, 64)
+		}
+	case http.StatusOK:
+		size = resp.ContentLength
+	default:
+		return nil, 0, fmt.Errorf("error fetching header of imageURL %s, received %s", imageURL, resp.Status)
+	}
+
+	header, err := readHeader(resp.Body)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error reading header of imageURL %s: %w", imageURL, err)
+	}
+	return header, max(size, 0), nil
+}
+
+func readHeader(r io.Reader) ([]byte, error) {
+	header := make([]byte, imageHeaderSize)
+	n, err := io.ReadFull(r, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, err
+	}
+	return header[:n], nil
+}
+
+// detectImageFormat identifies qcow2 images from the header magic and reads the virtual size
+// from the header. images with the mbr boot signature are raw disks, where the virtual size is
+// the file size. the sizes of compressed and unrecognised images, such as isos, are unknown
+func detectImageFormat(header []byte, size int64) sourceImageInfo {
+	if len(header) >= 32 && bytes.Equal(header[:4], qcow2Magic) {
+		// qcow2 header stores the virtual size as a big endian uint64 at offset 24
+		virtualSize := binary.BigEndian.Uint64(header[24:32])
+		return sourceImageInfo{
+			format:      ImageFormatQcow2,
+			size:        size,
+			virtualSize: int64(min(virtualSize, uint64(1<<63-1))), // #nosec G115 -- clamped to int64 range
+		}
+	}
+
+	for format, magic := range compressionMagic {
+		if bytes.HasPrefix(header, magic) {
+			return sourceImageInfo{format: format}
+		}
+	}
+
+	if len(header) == imageHeaderSize && bytes.Equal(header[imageHeaderSize-2:], mbrSignature) {
+		return sourceImageInfo{
+			format:      ImageFormatRaw,
+			size:        size,
+			virtualSize: size,
+		}
+	}
+	return sourceImageInfo{format: ImageFormatUnknown}
+}
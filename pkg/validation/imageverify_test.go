@@ -0,0 +1,33 @@
+package validation
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_DetectImageFormat(t *testing.T) {
+	assert := require.New(t)
+	header := make([]byte, imageHeaderSize)
+	copy(header, qcow2Magic)
+	binary.BigEndian.PutUint64(header[24:32], 10*1024*1024*1024)
+
+	info := detectImageFormat(header, 512*1024*1024)
+	assert.Equal(ImageFormatQcow2, info.format)
+	assert.Equal(int64(10*1024*1024*1024), info.virtualSize)
+	assert.Equal(int64(512*1024*1024), info.size)
+
+	raw := make([]byte, imageHeaderSize)
+	copy(raw[imageHeaderSize-2:], mbrSignature)
+	info = detectImageFormat(raw, 2048)
+	assert.Equal(ImageFormatRaw, info.format)
+	assert.Equal(int64(2048), info.size)
+	assert.Equal(int64(2048), info.virtualSize)
+
+	info = detectImageFormat([]byte{0xfd, '7', 'z', 'X', 'Z', 0x00, 0x00}, 2048)
+	assert.Equal(sourceImageInfo{format: "xz"}, info)
+
+	info = detectImageFormat(make([]byte, imageHeaderSize), 2048)
+	assert.Equal(sourceImageInfo{format: ImageFormatUnknown}, info)
+}
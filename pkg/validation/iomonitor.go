@@ -0,0 +1,224 @@
+package validation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	kubevirtv1 "kubevirt.io/api/core/v1"
+
+	"github.com/harvester/storage-validator/pkg/api"
+)
+
+const (
+	ioMonitorVolume     = "iomonitor"
+	ioMonitorRunFlag    = "/dev/shm/sv-io-run"
+	ioMonitorBootFile   = "/var/tmp/sv-io-boot"
+	ioMonitorRecordSize = 512
+	// ioMonitorInterval between writes in seconds, which is included in the reported stall
+	ioMonitorInterval = "0.1"
+)
+
+// ioMonitorTarget is a file or device in the guest receiving timestamped writes
+type ioMonitorTarget struct {
+	disk string
+	path string
+}
+
+// runVMMigrationWithIOMonitor live migrates the vm while the guest continuously writes
+// sequenced and timestamped records to the boot disk and a hotplugged disk. once migrated
+// the records are read back to identify lost writes, and the largest gap between writes
+// is reported as the io stall caused by the migration
+func (v *ValidationRun) runVMMigrationWithIOMonitor(ctx context.Context) error {
+	pvc := v.newHotplugPVC(corev1.PersistentVolumeBlock)
+	if err := v.clients.runtimeClient.Create(ctx, pvc); err != nil {
+		return fmt.Errorf("error creating pvc: %w", err)
+	}
+	v.createdObjects = append(v.createdObjects, pvc)
+
+	vmClient := v.clients.kubevirtClient.VirtualMachine(v.Configuration.Namespace)
+	if err := vmClient.AddVolume(ctx, v.vmName, newAddVolumeOptions(ioMonitorVolume, pvc.Name, kubevirtv1.DiskBusSCSI)); err != nil {
+		return fmt.Errorf("error attempting to hot plug disks: %w", err)
+	}
+	// harvester webhooks block pvc deletion if its hot plugged to a volume
+	defer func() {
+		if err := vmClient.RemoveVolume(context.TODO(), v.vmName, &kubevirtv1.RemoveVolumeOptions{Name: ioMonitorVolume}); err != nil {
+			logrus.Errorf("error attempting to remove hot plug disk %s: %v", ioMonitorVolume, err)
+		}
+	}()
+
+	if err := v.waitForHotplugVolumes(ctx, v.vmName, []string{pvc.Name}); err != nil {
+		return err
+	}
+
+	targets, err := v.startIOMonitor(ctx)
+	if err != nil {
+		return err
+	}
+
+	vmMigrationObject := v.newVMMigration()
+	migrateErr := v.migrateVM(ctx, vmMigrationObject)
+	// writers are stopped even when the migration failed, as the vm keeps running on the source
+	result, err := v.stopIOMonitor(ctx, targets)
+	if migrateErr != nil {
+		return migrateErr
+	}
+	if err != nil {
+		return err
+	}
+
+	result.DurationSeconds = migrationDuration(vmMigrationObject)
+	v.Report.MigrationIO = result
+	return evaluateMigrationIO(result, v.Configuration.Migration.MaxIOStallSeconds)
+}
+
+// startIOMonitor starts background writers in the guest. writers run detached from the
+// console session, as the serial console is disconnected while the vm is migrated
+func (v *ValidationRun) startIOMonitor(ctx context.Context) ([]ioMonitorTarget, error) {
+	guest, err := v.openGuestSession(ctx, v.vmName)
+	if err != nil {
+		return nil, err
+	}
+	defer guest.close()
+
+	// the hotplugged disk takes a moment to be discovered by the guest after it is attached
+	device, err := guest.run(ctx, fmt.Sprintf("for i in $(seq 60); do ls /dev/disk/by-id/*%[1]s >/dev/null 2>&1 && break; sleep 1; done; readlink -f /dev/disk/by-id/*%[1]s", ioMonitorVolume))
+	if err != nil {
+		return nil, fmt.Errorf("error locating hotplugged disk %s in guest: %w", ioMonitorVolume, err)
+	}
+
+	targets := []ioMonitorTarget{
+		{disk: "boot", path: ioMonitorBootFile},
+		{disk: "hotplug", path: strings.TrimSpace(device)},
+	}
+
+	if err := startIOWriters(ctx, guest, targets); err != nil {
+		return nil, err
+	}
+	return targets, nil
+}
+
+// startIOWriters starts a background writer in the guest for each target
+func startIOWriters(ctx context.Context, guest *guestSession, targets []ioMonitorTarget) error {
+	if _, err := guest.run(ctx, "touch "+ioMonitorRunFlag); err != nil {
+		return err
+	}
+	for _, target := range targets {
+		if _, err := guest.run(ctx, ioWriterCommand(target)); err != nil {
+			return fmt.Errorf("error starting writer for %s disk: %w", target.disk, err)
+		}
+	}
+	return nil
+}
+
+// stopIOMonitor stops the guest writers, and verifies the records written to each target
+func (v *ValidationRun) stopIOMonitor(ctx context.Context, targets []ioMonitorTarget) (*api.MigrationIOResult, error) {
+	guest, err := v.openGuestSession(ctx, v.vmName)
+	if err != nil {
+		return nil, err
+	}
+	defer guest.close()
+
+	if _, err := guest.run(ctx, "rm -f "+ioMonitorRunFlag); err != nil {
+		return nil, err
+	}
+
+	result := &api.MigrationIOResult{}
+	for _, target := range targets {
+		// wait for a pending write to complete before reading back the records
+		if _, err := guest.run(ctx, fmt.Sprintf("while kill -0 $(cat %s) 2>/dev/null; do sleep 0.5; done", ioMonitorFile(target, "pid"))); err != nil {
+			return nil, err
+		}
+
+		output, err := guest.run(ctx, ioVerifyCommand(target))
+		if err != nil {
+			return nil, fmt.Errorf("error verifying writes to %s disk: %w", target.disk, err)
+		}
+
+		diskResult, err := parseIOMonitorSummary(target.disk, output)
+		if err != nil {
+			return nil, err
+		}
+		result.Disks = append(result.Disks, diskResult)
+	}
+
+	if _, err := guest.run(ctx, "rm -f "+ioMonitorBootFile); err != nil {
+		logrus.Warnf("error removing %s from guest: %v", ioMonitorBootFile, err)
+	}
+	return result, nil
+}
+
+func ioMonitorFile(target ioMonitorTarget, suffix string) string {
+	return fmt.Sprintf("/dev/shm/sv-io-%s.%s", target.disk, suffix)
+}
+
+// ioWriterCommand writes records of the form "<sequence> <timestamp ms>" to consecutive
+// offsets of the target with direct io, so a stalled write delays the following timestamp.
+// the sequence of the last completed write is kept in memory to identify lost writes
+func ioWriterCommand(target ioMonitorTarget) string {
+	script := fmt.Sprintf(`i=0; while [ -e %s ]; do printf "%%d %%s\n" $i $(date +%%s%%3N) | dd of=%s bs=%d seek=$i count=1 oflag=direct conv=notrunc,sync status=none && echo $i > %s; i=$((i+1)); sleep %s; done`,
+		ioMonitorRunFlag, target.path, ioMonitorRecordSize, ioMonitorFile(target, "last"), ioMonitorInterval)
+	return fmt.Sprintf("nohup sh -c '%s' >/dev/null 2>&1 & echo $! > %s", script, ioMonitorFile(target, "pid"))
+}
+
+// ioVerifyCommand reads back the completed records, and prints the number of records
+// expected, the number found intact and the largest gap in ms between consecutive records
+func ioVerifyCommand(target ioMonitorTarget) string {
+	return fmt.Sprintf(`expected=$(( $(cat %s 2>/dev/null || echo -1) + 1 )); dd if=%s bs=%d count=$expected iflag=direct status=none | tr -d '\000' | awk -v expected=$expected '$1 ~ /^[0-9]+$/ && $1 < expected && !seen[$1]++ { ok++; if (n++ && $2-prev > max) max=$2-prev; prev=$2 } END { printf "%%d %%d %%d\n", expected, ok, max }'`,
+		ioMonitorFile(target, "last"), target.path, ioMonitorRecordSize)
+}
+
+// parseIOMonitorSummary parses the summary printed by ioVerifyCommand
+func parseIOMonitorSummary(disk, output string) (api.DiskIOResult, error) {
+	fields := strings.Fields(output)
+	if len(fields) < 3 {
+		return api.DiskIOResult{}, fmt.Errorf("unexpected io summary for %s disk: %q", disk, output)
+	}
+	fields = fields[len(fields)-3:]
+
+	var values [3]int
+	for i, field := range fields {
+		value, err := strconv.Atoi(field)
+		if err != nil {
+			return api.DiskIOResult{}, fmt.Errorf("unexpected io summary for %s disk: %q", disk, output)
+		}
+		values[i] = value
+	}
+
+	return api.DiskIOResult{
+		Disk:       disk,
+		Writes:     values[0],
+		LostWrites: values[0] - values[1],
+		MaxStallMs: float64(values[2]),
+	}, nil
+}
+
+// evaluateMigrationIO fails when any writes were lost, or a disk stalled for longer than allowed
+func evaluateMigrationIO(result *api.MigrationIOResult, maxStallSeconds float64) error {
+	var errs []error
+	for _, disk := range result.Disks {
+		if disk.Writes == 0 {
+			errs = append(errs, fmt.Errorf("no writes completed to %s disk during migration", disk.Disk))
+		}
+		if disk.LostWrites > 0 {
+			errs = append(errs, fmt.Errorf("%d of %d writes to %s disk were lost during migration", disk.LostWrites, disk.Writes, disk.Disk))
+		}
+		if maxStallSeconds > 0 && disk.MaxStallMs > maxStallSeconds*1000 {
+			errs = append(errs, fmt.Errorf("writes to %s disk stalled for %.0fms during migration, exceeding %.0fms", disk.Disk, disk.MaxStallMs, maxStallSeconds*1000))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// migrationDuration returns the duration of the migration from its start and end timestamps
+func migrationDuration(vmim *kubevirtv1.VirtualMachineInstanceMigration) float64 {
+	state := vmim.Status.MigrationState
+	if state == nil || state.StartTimestamp == nil || state.EndTimestamp == nil {
+		return 0
+	}
+	return state.EndTimestamp.Sub(state.StartTimestamp.Time).Seconds()
+}
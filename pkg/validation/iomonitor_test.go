@@ -0,0 +1,23 @@
+package validation
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/harvester/storage-validator/pkg/api"
+)
+
+func Test_ParseIOMonitorSummary(t *testing.T) {
+	assert := require.New(t)
+	result, err := parseIOMonitorSummary("boot", "\n412 410 2350\n")
+	assert.NoError(err)
+	assert.Equal(api.DiskIOResult{Disk: "boot", Writes: 412, LostWrites: 2, MaxStallMs: 2350}, result)
+
+	_, err = parseIOMonitorSummary("boot", "dd: failed to open")
+	assert.Error(err)
+
+	err = evaluateMigrationIO(&api.MigrationIOResult{Disks: []api.DiskIOResult{result}}, 2)
+	assert.ErrorContains(err, "2 of 412 writes to boot disk were lost")
+	assert.ErrorContains(err, "stalled for 2350ms")
+}
@@ -2,49 +2,216 @@ package validation
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	kubevirtv1 "kubevirt.io/api/core/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/harvester/storage-validator/pkg/api"
 )
 
 func (v *ValidationRun) runVMMigration(ctx context.Context) error {
+	if v.Configuration.Migration.MonitorIO {
+		return v.runVMMigrationWithIOMonitor(ctx)
+	}
+	return v.migrateVM(ctx, v.newVMMigration())
+}
 
-	vmMigrationObject := &kubevirtv1.VirtualMachineInstanceMigration{
+func (v *ValidationRun) planRunVMMigration() []client.Object {
+	if v.Configuration.Migration.MonitorIO {
+		return []client.Object{v.newHotplugPVC(corev1.PersistentVolumeBlock), v.newVMMigration()}
+	}
+	return []client.Object{v.newVMMigration()}
+}
+
+// runVMMigrationRoundRobin migrates the vm through every ready and schedulable node and back
+// to the node it started on, ensuring the volumes are attached after every hop. the result of
+// each hop is added to the migration matrix of the report, and failed hops do not stop the run
+// so that every misbehaving node is identified
+func (v *ValidationRun) runVMMigrationRoundRobin(ctx context.Context) error {
+	if !v.Configuration.Migration.RoundRobin {
+		return skipCheck("round robin migration not enabled, set migration.roundRobin to migrate the vm across every node")
+	}
+
+	vmiObj := &kubevirtv1.VirtualMachineInstance{}
+	if err := v.clients.runtimeClient.Get(ctx, types.NamespacedName{Name: v.vmName, Namespace: v.Configuration.Namespace}, vmiObj); err != nil {
+		return fmt.Errorf("error looking up vmi %s: %w", v.vmName, err)
+	}
+
+	nodes, err := v.schedulableNodes(ctx)
+	if err != nil {
+		return err
+	}
+
+	targets := migrationTargets(nodes, vmiObj.Status.NodeName)
+	if len(targets) < 2 {
+		return skipCheck("round robin migration needs at least 2 schedulable nodes, found %d", len(nodes))
+	}
+
+	var failed []string
+	for _, target := range targets {
+		if err := v.clients.runtimeClient.Get(ctx, client.ObjectKeyFromObject(vmiObj), vmiObj); err != nil {
+			return fmt.Errorf("error looking up vmi %s: %w", vmiObj.Name, err)
+		}
+
+		result := api.MigrationResult{
+			SourceNode: vmiObj.Status.NodeName,
+			TargetNode: target.Name,
+		}
+		start := time.Now()
+		err := v.migrateVMToNode(ctx, target)
+		result.DurationSeconds = time.Since(start).Round(time.Second).Seconds()
+		if err != nil {
+			result.Status = api.CheckStatusFailure
+			result.Info = err.Error()
+			failed = append(failed, fmt.Sprintf("%s -> %s", result.SourceNode, result.TargetNode))
+			logrus.Errorf("migration of vm %s from %s to %s failed: %v", v.vmName, result.SourceNode, result.TargetNode, err)
+		} else {
+			result.Status = api.CheckStatusSuccess
+			logrus.Infof("migrated vm %s from %s to %s in %.0fs", v.vmName, result.SourceNode, result.TargetNode, result.DurationSeconds)
+		}
+		v.Report.MigrationMatrix = append(v.Report.MigrationMatrix, result)
+
+		// no further hops can be attempted once the run has timed out
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("vm migration failed between nodes: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// planRunVMMigrationRoundRobin renders the migration of a single hop to a placeholder node, as
+// the nodes and so the number of hops are only known at runtime
+func (v *ValidationRun) planRunVMMigrationRoundRobin() []client.Object {
+	if !v.Configuration.Migration.RoundRobin {
+		return nil
+	}
+	target := corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: plannedNodeName}}
+	return []client.Object{v.newVMMigrationToNode(target)}
+}
+
+// migrateVMToNode migrates the vm to the node, and ensures the vmi volumes are attached once there
+func (v *ValidationRun) migrateVMToNode(ctx context.Context, node corev1.Node) error {
+	if err := v.migrateVM(ctx, v.newVMMigrationToNode(node)); err != nil {
+		return err
+	}
+
+	vmiObj := &kubevirtv1.VirtualMachineInstance{
 		ObjectMeta: metav1.ObjectMeta{
-			GenerateName: "migration-storage-validator-",
-			Namespace:    v.Configuration.Namespace,
-		},
-		Spec: kubevirtv1.VirtualMachineInstanceMigrationSpec{
-			VMIName: v.vmName,
+			Name:      v.vmName,
+			Namespace: v.Configuration.Namespace,
 		},
 	}
+	verifyVMIOnNode := func(obj client.Object) (bool, error) {
+		vmiObj, ok := obj.(*kubevirtv1.VirtualMachineInstance)
+		if !ok {
+			return false, fmt.Errorf("error asserting object %v to vmi", client.ObjectKeyFromObject(obj))
+		}
+		if vmiObj.Status.NodeName != node.Name || vmiObj.Status.Phase != kubevirtv1.Running {
+			return false, nil
+		}
+		return vmiVolumesReady(vmiObj), nil
+	}
+	return v.waitUntilObjectIsReady(ctx, vmiObj, verifyVMIOnNode)
+}
 
+// migrateVM creates the migration and waits until it succeeds
+func (v *ValidationRun) migrateVM(ctx context.Context, vmMigrationObject *kubevirtv1.VirtualMachineInstanceMigration) error {
 	if err := v.clients.runtimeClient.Create(ctx, vmMigrationObject); err != nil {
 		return fmt.Errorf("error creating vm migration: %w", err)
 	}
 
 	v.createdObjects = append(v.createdObjects, vmMigrationObject)
 
-	// reconcile if vm migration is successful
-	checkMigrationStatus := func(obj client.Object) (bool, error) {
-		vmimObj, ok := obj.(*kubevirtv1.VirtualMachineInstanceMigration)
-		if !ok {
-			return false, fmt.Errorf("error asserting object %v to vm migration", client.ObjectKeyFromObject(obj))
+	// wait until migration is completed
+	return v.waitUntilObjectIsReady(ctx, vmMigrationObject, verifyMigrationSucceeded)
+}
+
+// reconcile if vm migration is successful. a failed migration is not retried
+// by kubevirt, so there is no point waiting for it any longer
+func verifyMigrationSucceeded(obj client.Object) (bool, error) {
+	vmimObj, ok := obj.(*kubevirtv1.VirtualMachineInstanceMigration)
+	if !ok {
+		return false, fmt.Errorf("error asserting object %v to vm migration", client.ObjectKeyFromObject(obj))
+	}
+
+	switch vmimObj.Status.Phase {
+	case kubevirtv1.MigrationSucceeded:
+		return true, nil
+	case kubevirtv1.MigrationFailed:
+		return false, errors.New(describeObjectStatus(vmimObj))
+	}
+	return false, nil
+}
+
+// schedulableNodes returns the ready nodes which accept new workloads, sorted by name
+func (v *ValidationRun) schedulableNodes(ctx context.Context) ([]corev1.Node, error) {
+	nodeList := &corev1.NodeList{}
+	if err := v.clients.runtimeClient.List(ctx, nodeList); err != nil {
+		return nil, fmt.Errorf("error listing nodes: %w", err)
+	}
+
+	var nodes []corev1.Node
+	for _, node := range nodeList.Items {
+		if node.DeletionTimestamp == nil && !node.Spec.Unschedulable && isNodeReady(node) {
+			nodes = append(nodes, node)
 		}
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Name < nodes[j].Name
+	})
+	return nodes, nil
+}
 
-		if vmimObj.Status.Phase == kubevirtv1.MigrationSucceeded {
-			return true, nil
+// migrationTargets orders the nodes into a round trip starting after the current node and
+// ending on it, so every node is used as both source and target of a migration
+func migrationTargets(nodes []corev1.Node, currentNode string) []corev1.Node {
+	start := 0
+	var targets []corev1.Node
+	for i, node := range nodes {
+		if node.Name == currentNode {
+			start = i + 1
 		}
-		return false, nil
+	}
 
+	for i := 0; i < len(nodes); i++ {
+		targets = append(targets, nodes[(start+i)%len(nodes)])
 	}
+	return targets
+}
 
-	// wait until migration is completed
-	if err := v.waitUntilObjectIsReady(ctx, vmMigrationObject, checkMigrationStatus); err != nil {
-		return err
+// newVMMigration defines a live migration of the validation vm
+func (v *ValidationRun) newVMMigration() *kubevirtv1.VirtualMachineInstanceMigration {
+	vmMigrationObject := &kubevirtv1.VirtualMachineInstanceMigration{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "migration-storage-validator-",
+			Namespace:    v.Configuration.Namespace,
+		},
+		Spec: kubevirtv1.VirtualMachineInstanceMigrationSpec{
+			VMIName: v.vmName,
+		},
 	}
 
-	return nil
+	return vmMigrationObject
+}
+
+// newVMMigrationToNode defines a live migration of the validation vm restricted to the node
+func (v *ValidationRun) newVMMigrationToNode(node corev1.Node) *kubevirtv1.VirtualMachineInstanceMigration {
+	vmMigrationObject := v.newVMMigration()
+	vmMigrationObject.Spec.AddedNodeSelector = map[string]string{
+		corev1.LabelHostname: nodeHostname(node),
+	}
+	return vmMigrationObject
 }
@@ -0,0 +1,45 @@
+package validation
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubevirtv1 "kubevirt.io/api/core/v1"
+
+	"github.com/harvester/storage-validator/pkg/api"
+)
+
+func Test_MigrationTargets(t *testing.T) {
+	assert := require.New(t)
+	var nodes []corev1.Node
+	for _, name := range []string{"node-1", "node-2", "node-3"} {
+		nodes = append(nodes, corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}})
+	}
+
+	names := func(nodes []corev1.Node) []string {
+		var result []string
+		for _, node := range nodes {
+			result = append(result, node.Name)
+		}
+		return result
+	}
+
+	assert.Equal([]string{"node-3", "node-1", "node-2"}, names(migrationTargets(nodes, "node-2")))
+	// vm on a node which is not schedulable visits every schedulable node
+	assert.Equal([]string{"node-1", "node-2", "node-3"}, names(migrationTargets(nodes, "node-4")))
+}
+
+func Test_PlanRunVMMigrationRoundRobin(t *testing.T) {
+	assert := require.New(t)
+	v := &ValidationRun{Configuration: &api.Configuration{Namespace: "default"}}
+	assert.Empty(v.planRunVMMigrationRoundRobin())
+
+	v.Configuration.Migration.RoundRobin = true
+	objs := v.planRunVMMigrationRoundRobin()
+	assert.Len(objs, 1)
+	migration, ok := objs[0].(*kubevirtv1.VirtualMachineInstanceMigration)
+	assert.True(ok)
+	assert.Equal(map[string]string{corev1.LabelHostname: plannedNodeName}, migration.Spec.AddedNodeSelector)
+}
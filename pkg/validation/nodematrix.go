@@ -0,0 +1,126 @@
+package validation
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/harvester/storage-validator/pkg/api"
+)
+
+const (
+	nodeProbeName = "node-probe-storage-validation-"
+	// nodeProbeTimeout bounds the probe of each node, so a broken node is reported
+	// without consuming the timeout of the whole run
+	nodeProbeTimeout = 5 * time.Minute
+)
+
+// nodeProbe tracks the objects and outcome of the probe on a single node
+type nodeProbe struct {
+	objects []client.Object
+	result  api.NodeProbeResult
+}
+
+// runNodeMatrix provisions a fresh pvc on every schedulable node, and runs a short lived pod
+// pinned to the node which writes to the volume and reads the data back. nodes are probed in
+// parallel, and the result of each node is added to the node matrix of the report, so a single
+// node missing host dependencies such as the iscsi initiator is identified
+func (v *ValidationRun) runNodeMatrix(ctx context.Context) error {
+	nodes, err := v.schedulableNodes(ctx)
+	if err != nil {
+		return err
+	}
+
+	probes := make([]nodeProbe, len(nodes))
+	var wg sync.WaitGroup
+	for i := range nodes {
+		wg.Add(1)
+		go func(node corev1.Node, probe *nodeProbe) {
+			defer wg.Done()
+			v.probeNode(ctx, node, probe)
+		}(nodes[i], &probes[i])
+	}
+	wg.Wait()
+
+	var failed []string
+	for _, probe := range probes {
+		v.createdObjects = append(v.createdObjects, probe.objects...)
+		v.Report.NodeMatrix = append(v.Report.NodeMatrix, probe.result)
+		if probe.result.Status == api.CheckStatusFailure {
+			failed = append(failed, probe.result.Node)
+			logrus.Errorf("volume probe on node %s failed: %s", probe.result.Node, probe.result.Info)
+		}
+	}
+
+	// probes are short lived, and removed to free up resources for subsequent checks
+	for _, probe := range probes {
+		for _, obj := range probe.objects {
+			if err := v.clients.runtimeClient.Delete(ctx, obj); err != nil && !apierrors.IsNotFound(err) {
+				logrus.Errorf("error deleting %s %s: %v", objectKind(obj), obj.GetName(), err)
+			}
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("volume could not be used on %d of %d nodes: %s", len(failed), len(nodes), strings.Join(failed, ", "))
+	}
+	logrus.Infof("volume mounted, written and read back on all %d nodes", len(nodes))
+	return nil
+}
+
+// planRunNodeMatrix renders the probe of a single node, as the nodes are only known at runtime
+func (v *ValidationRun) planRunNodeMatrix() []client.Object {
+	pvc := v.newBaselinePVC(nodeProbeName)
+	return []client.Object{pvc, v.newNodeProbePod(plannedNodeName, plannedName(pvc))}
+}
+
+// probeNode creates a pvc and a pod using it on the node, and waits for the pod to complete
+func (v *ValidationRun) probeNode(ctx context.Context, node corev1.Node, probe *nodeProbe) {
+	probe.result = api.NodeProbeResult{Node: node.Name, Status: api.CheckStatusSuccess}
+	start := time.Now()
+	err := func() error {
+		pvc := v.newBaselinePVC(nodeProbeName)
+		if err := v.clients.runtimeClient.Create(ctx, pvc); err != nil {
+			return fmt.Errorf("error creating pvc: %w", err)
+		}
+		probe.objects = append(probe.objects, pvc)
+
+		pod := v.newNodeProbePod(nodeHostname(node), pvc.Name)
+		if err := v.clients.runtimeClient.Create(ctx, pod); err != nil {
+			return fmt.Errorf("error creating pod: %w", err)
+		}
+		// the pod is removed before the pvc
+		probe.objects = append([]client.Object{pod}, probe.objects...)
+
+		probeCtx, cancel := context.WithTimeout(ctx, nodeProbeTimeout)
+		defer cancel()
+		return v.waitUntilObjectIsReady(probeCtx, pod, verifyPodSucceeded)
+	}()
+	probe.result.DurationSeconds = time.Since(start).Round(time.Second).Seconds()
+	if err != nil {
+		probe.result.Status = api.CheckStatusFailure
+		probe.result.Info = err.Error()
+	}
+}
+
+// newNodeProbePod defines a pod on the node with the hostname, which writes random data to the
+// mounted pvc and ensures the same data is read back with direct io, bypassing the page cache.
+// the pod is pinned through a node selector rather than its node name, so the scheduler
+// selects the node for volumes from storage classes binding on first consumer
+func (v *ValidationRun) newNodeProbePod(hostname, pvcName string) *corev1.Pod {
+	script := fmt.Sprintf(`dd if=/dev/urandom of=/tmp/probe bs=1M count=16 status=none && dd if=/tmp/probe of=%[1]s/probe bs=1M conv=fsync status=none && [ "$(md5sum < /tmp/probe)" = "$(dd if=%[1]s/probe bs=1M iflag=direct status=none | md5sum)" ]`,
+		probeMountPath)
+
+	pod := v.newProbePod(nodeProbeName, pvcName)
+	pod.Spec.RestartPolicy = corev1.RestartPolicyNever
+	pod.Spec.NodeSelector = map[string]string{corev1.LabelHostname: hostname}
+	pod.Spec.Containers[0].Command = []string{"sh", "-c", script}
+	return pod
+}
@@ -0,0 +1,418 @@
+package validation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+	kubevirtv1 "kubevirt.io/api/core/v1"
+	cdiv1 "kubevirt.io/containerized-data-importer-api/pkg/apis/core/v1beta1"
+	sdkapi "kubevirt.io/controller-lifecycle-operator-sdk/api"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/harvester/storage-validator/pkg/api"
+)
+
+const (
+	hotplugFeatureGate     = "HotplugVolumes"
+	longhornNamespace      = "longhorn-system"
+	longhornManager        = "longhorn-manager"
+	defaultCPUAllocation   = 10 // kubevirt requests 1/10th of a cpu per vcpu unless configured otherwise
+	vmCountQuotaResource   = "count/virtualmachines.kubevirt.io"
+	storageClassQuotaScope = ".storageclass.storage.k8s.io/"
+)
+
+// preflightCheck is a single item verified before any objects are created
+type preflightCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+	// Requires lists the storage features the item depends on, it is reported as
+	// not-applicable when the storage class does not support any of them
+	Requires []string
+}
+
+// preFlightChecks verifies the cluster is able to run the validation. every item is run and
+// added to the preflight section of the report, and the run is aborted if any of them fail
+func (v *ValidationRun) preFlightChecks() error {
+	checks := []preflightCheck{
+		{Name: "image source", Check: v.verifyImageSource},
+		{Name: "ready nodes", Check: v.verifyReadyNodes},
+		{Name: "kubevirt deployed", Check: v.verifyKubeVirtDeployed},
+		{Name: "hotplug volumes feature gate", Check: v.verifyHotplugFeatureGate},
+		{Name: "cdi deployed", Check: v.verifyCDIDeployed},
+		{Name: "longhorn healthy", Check: v.verifyLonghornHealthy},
+		{Name: "namespace exists", Check: v.verifyNamespaceExists},
+		{Name: "resource quota", Check: v.verifyResourceQuota},
+		{Name: "migration capacity", Check: v.verifyMigrationCapacity, Requires: []string{api.FeatureRWX}},
+	}
+
+	var failed []string
+	for _, check := range checks {
+		result := api.Result{Name: check.Name, Status: api.CheckStatusSuccess}
+		if reason := v.notApplicable(check.Requires); reason != "" {
+			result.Status = api.CheckStatusNotApplicable
+			result.Info = reason
+		} else if err := check.Check(v.ctx); err != nil {
+			result.Status = api.CheckStatusFailure
+			result.Info = err.Error()
+			failed = append(failed, check.Name)
+			logrus.Errorf("preflight check %s failed: %v", check.Name, err)
+		}
+		v.Report.Preflight = append(v.Report.Preflight, result)
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("preflight checks failed: %s, aborting run", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func (v *ValidationRun) verifyImageSource(_ context.Context) error {
+	if v.Configuration.ImageURL == "" && v.Configuration.ImageFile == "" {
+		return errors.New("no imageURL or imageFile specified")
+	}
+
+	if v.Configuration.ImageURL != "" && v.Configuration.ImageFile != "" {
+		return errors.New("only one of imageURL or imageFile can be specified")
+	}
+	return nil
+}
+
+func (v *ValidationRun) verifyReadyNodes(ctx context.Context) error {
+	nodeList := &corev1.NodeList{}
+	if err := v.clients.runtimeClient.List(ctx, nodeList); err != nil {
+		return fmt.Errorf("error listing nodes: %w", err)
+	}
+
+	count := 0
+	for _, node := range nodeList.Items {
+		if node.DeletionTimestamp == nil && isNodeReady(node) {
+			count++
+		}
+	}
+
+	if count < 2 {
+		return fmt.Errorf("cluster does not have atleast 2 ready nodes, found %d", count)
+	}
+	return nil
+}
+
+// kubeVirt returns the kubevirt install of the cluster
+func (v *ValidationRun) kubeVirt(ctx context.Context) (*kubevirtv1.KubeVirt, error) {
+	kubevirtList := &kubevirtv1.KubeVirtList{}
+	if err := v.clients.runtimeClient.List(ctx, kubevirtList); err != nil {
+		return nil, fmt.Errorf("error listing kubevirt: %w", err)
+	}
+	if len(kubevirtList.Items) == 0 {
+		return nil, errors.New("no kubevirt install found")
+	}
+	return &kubevirtList.Items[0], nil
+}
+
+func (v *ValidationRun) verifyKubeVirtDeployed(ctx context.Context) error {
+	kv, err := v.kubeVirt(ctx)
+	if err != nil {
+		return err
+	}
+	if kv.Status.Phase != kubevirtv1.KubeVirtPhaseDeployed {
+		return fmt.Errorf("kubevirt %s/%s is in phase %q, expected %s", kv.Namespace, kv.Name, kv.Status.Phase, kubevirtv1.KubeVirtPhaseDeployed)
+	}
+	return nil
+}
+
+func (v *ValidationRun) verifyHotplugFeatureGate(ctx context.Context) error {
+	kv, err := v.kubeVirt(ctx)
+	if err != nil {
+		return err
+	}
+	if kv.Spec.Configuration.DeveloperConfiguration == nil || !slices.Contains(kv.Spec.Configuration.DeveloperConfiguration.FeatureGates, hotplugFeatureGate) {
+		return fmt.Errorf("feature gate %s is not enabled in kubevirt %s/%s, volumes cannot be hot plugged", hotplugFeatureGate, kv.Namespace, kv.Name)
+	}
+	return nil
+}
+
+// cdi returns the cdi install of the cluster
+func (v *ValidationRun) cdi(ctx context.Context) (*cdiv1.CDI, error) {
+	cdiList := &cdiv1.CDIList{}
+	if err := v.clients.runtimeClient.List(ctx, cdiList); err != nil {
+		return nil, fmt.Errorf("error listing cdi: %w", err)
+	}
+	if len(cdiList.Items) == 0 {
+		return nil, errors.New("no cdi install found")
+	}
+	return &cdiList.Items[0], nil
+}
+
+func (v *ValidationRun) verifyCDIDeployed(ctx context.Context) error {
+	cdi, err := v.cdi(ctx)
+	if err != nil {
+		return err
+	}
+	if cdi.Status.Phase != sdkapi.PhaseDeployed {
+		return fmt.Errorf("cdi %s is in phase %q, expected %s", cdi.Name, cdi.Status.Phase, sdkapi.PhaseDeployed)
+	}
+	return nil
+}
+
+// verifyLonghornHealthy ensures the longhorn manager runs on every node, as harvester
+// relies on longhorn for vm images regardless of the storage class under validation
+func (v *ValidationRun) verifyLonghornHealthy(ctx context.Context) error {
+	ds, err := v.longhornManager(ctx)
+	if err != nil {
+		return err
+	}
+	if ds.Status.DesiredNumberScheduled == 0 || ds.Status.NumberReady != ds.Status.DesiredNumberScheduled {
+		return fmt.Errorf("daemonset %s/%s has %d of %d pods ready", longhornNamespace, longhornManager, ds.Status.NumberReady, ds.Status.DesiredNumberScheduled)
+	}
+	return nil
+}
+
+// longhornManager returns the daemonset running the longhorn manager on every node
+func (v *ValidationRun) longhornManager(ctx context.Context) (*appsv1.DaemonSet, error) {
+	ds := &appsv1.DaemonSet{}
+	if err := v.clients.runtimeClient.Get(ctx, types.NamespacedName{Name: longhornManager, Namespace: longhornNamespace}, ds); err != nil {
+		return nil, fmt.Errorf("error fetching daemonset %s/%s: %w", longhornNamespace, longhornManager, err)
+	}
+	return ds, nil
+}
+
+func (v *ValidationRun) verifyNamespaceExists(ctx context.Context) error {
+	ns := &corev1.Namespace{}
+	if err := v.clients.runtimeClient.Get(ctx, types.NamespacedName{Name: v.Configuration.Namespace}, ns); err != nil {
+		return fmt.Errorf("error fetching namespace %s: %w", v.Configuration.Namespace, err)
+	}
+	if ns.DeletionTimestamp != nil {
+		return fmt.Errorf("namespace %s is being deleted", v.Configuration.Namespace)
+	}
+	return nil
+}
+
+// verifyResourceQuota ensures the quotas of the namespace leave room for the objects planned
+// by the applicable checks. the objects are summed up, even though some are removed before
+// later checks run, so the estimate errs on the side of caution
+func (v *ValidationRun) verifyResourceQuota(ctx context.Context) error {
+	quotaList := &corev1.ResourceQuotaList{}
+	if err := v.clients.runtimeClient.List(ctx, quotaList, client.InNamespace(v.Configuration.Namespace)); err != nil {
+		return fmt.Errorf("error listing resourcequotas: %w", err)
+	}
+	if len(quotaList.Items) == 0 {
+		return nil
+	}
+
+	kv, err := v.kubeVirt(ctx)
+	if err != nil {
+		return err
+	}
+	planned := plannedUsage(v.plannedObjects(), cpuAllocationRatio(kv))
+
+	var violations []string
+	for _, quota := range quotaList.Items {
+		violations = append(violations, quotaViolations(quota, planned)...)
+	}
+	if len(violations) > 0 {
+		return fmt.Errorf("resource quota does not allow the planned objects: %s", strings.Join(violations, ", "))
+	}
+	return nil
+}
+
+// verifyMigrationCapacity ensures at least two nodes have enough unreserved cpu and memory
+// to run the validation vm, so it can be live migrated between them. the requests of the vm
+// exclude the overhead added by kubevirt, so the estimate is optimistic
+func (v *ValidationRun) verifyMigrationCapacity(ctx context.Context) error {
+	kv, err := v.kubeVirt(ctx)
+	if err != nil {
+		return err
+	}
+	cpu, memory, err := v.vmRequests(cpuAllocationRatio(kv))
+	if err != nil {
+		return err
+	}
+
+	nodes, err := v.schedulableNodes(ctx)
+	if err != nil {
+		return err
+	}
+	podList := &corev1.PodList{}
+	if err := v.clients.runtimeClient.List(ctx, podList); err != nil {
+		return fmt.Errorf("error listing pods: %w", err)
+	}
+
+	var fits int
+	var capacity []string
+	for _, node := range nodes {
+		freeCPU, freeMemory := unreservedResources(node, podList.Items)
+		if freeCPU.Cmp(cpu) >= 0 && freeMemory.Cmp(memory) >= 0 {
+			fits++
+		}
+		capacity = append(capacity, fmt.Sprintf("%s (cpu %s, memory %s)", node.Name, freeCPU.String(), freeMemory.String()))
+	}
+	if fits < 2 {
+		return fmt.Errorf("vm requests cpu %s and memory %s excluding the kubevirt overhead, which fit on %d nodes, at least 2 are needed for migration. unreserved resources: %s",
+			cpu.String(), memory.String(), fits, strings.Join(capacity, ", "))
+	}
+	return nil
+}
+
+// plannedObjects returns the objects planned by the checks which are applicable to the storage class
+func (v *ValidationRun) plannedObjects() []client.Object {
+	// plans record placeholder names of objects referenced by later checks, which are
+	// restored so the run starts from a clean state
+	pvcName, vmImageName, vmName, bootPVCName := v.pvcName, v.vmImageName, v.vmName, v.bootPVCName
+	defer func() {
+		v.pvcName, v.vmImageName, v.vmName, v.bootPVCName = pvcName, vmImageName, vmName, bootPVCName
+	}()
+
+	var objs []client.Object
+	for _, check := range v.validations() {
+		if check.Plan == nil || v.notApplicable(check.Requires) != "" {
+			continue
+		}
+		objs = append(objs, check.Plan()...)
+	}
+	return objs
+}
+
+// cpuAllocationRatio returns the share of a physical cpu requested by kubevirt for each vcpu
+func cpuAllocationRatio(kv *kubevirtv1.KubeVirt) int {
+	if kv.Spec.Configuration.DeveloperConfiguration != nil && kv.Spec.Configuration.DeveloperConfiguration.CPUAllocationRatio > 0 {
+		return kv.Spec.Configuration.DeveloperConfiguration.CPUAllocationRatio
+	}
+	return defaultCPUAllocation
+}
+
+// vmRequests returns the cpu and memory requested by the virt-launcher pod of the validation vm,
+// excluding the overhead added by kubevirt
+func (v *ValidationRun) vmRequests(ratio int) (resource.Quantity, resource.Quantity, error) {
+	memory, err := resource.ParseQuantity(v.Configuration.VMConfig.Memory)
+	if err != nil {
+		return resource.Quantity{}, resource.Quantity{}, fmt.Errorf("error parsing vm memory %s: %w", v.Configuration.VMConfig.Memory, err)
+	}
+	return vcpuRequest(v.Configuration.VMConfig.CPU, ratio), memory, nil
+}
+
+func vcpuRequest(vcpus uint32, ratio int) resource.Quantity {
+	return *resource.NewMilliQuantity(int64(vcpus)*1000/int64(ratio), resource.DecimalSI)
+}
+
+// plannedUsage sums the objects as they are counted by a resource quota
+func plannedUsage(objs []client.Object, ratio int) corev1.ResourceList {
+	usage := corev1.ResourceList{}
+	add := func(name corev1.ResourceName, quantity resource.Quantity) {
+		total := usage[name]
+		total.Add(quantity)
+		usage[name] = total
+	}
+	one := *resource.NewQuantity(1, resource.DecimalSI)
+	addPVC := func(storageClass *string, requests corev1.ResourceList) {
+		add(corev1.ResourcePersistentVolumeClaims, one)
+		add(corev1.ResourceRequestsStorage, requests[corev1.ResourceStorage])
+		if storageClass != nil {
+			add(corev1.ResourceName(*storageClass+storageClassQuotaScope+string(corev1.ResourcePersistentVolumeClaims)), one)
+			add(corev1.ResourceName(*storageClass+storageClassQuotaScope+string(corev1.ResourceRequestsStorage)), requests[corev1.ResourceStorage])
+		}
+	}
+
+	for _, obj := range objs {
+		switch o := obj.(type) {
+		case *corev1.PersistentVolumeClaim:
+			addPVC(o.Spec.StorageClassName, o.Spec.Resources.Requests)
+		case *cdiv1.DataVolume:
+			switch {
+			case o.Spec.Storage != nil:
+				addPVC(o.Spec.Storage.StorageClassName, o.Spec.Storage.Resources.Requests)
+			case o.Spec.PVC != nil:
+				addPVC(o.Spec.PVC.StorageClassName, o.Spec.PVC.Resources.Requests)
+			}
+		case *corev1.Pod:
+			add(corev1.ResourcePods, one)
+		case *kubevirtv1.VirtualMachine:
+			add(vmCountQuotaResource, one)
+			// each vm runs in a virt-launcher pod
+			add(corev1.ResourcePods, one)
+			domain := o.Spec.Template.Spec.Domain
+			if domain.CPU != nil {
+				add(corev1.ResourceRequestsCPU, vcpuRequest(domain.CPU.Cores*max(domain.CPU.Sockets, 1)*max(domain.CPU.Threads, 1), ratio))
+			}
+			if domain.Memory != nil && domain.Memory.Guest != nil {
+				add(corev1.ResourceRequestsMemory, *domain.Memory.Guest)
+			}
+		}
+	}
+	return usage
+}
+
+// quotaViolations lists the resources of the quota which cannot fit the planned usage
+func quotaViolations(quota corev1.ResourceQuota, planned corev1.ResourceList) []string {
+	var violations []string
+	for name, hard := range quota.Status.Hard {
+		want, ok := planned[name]
+		if !ok {
+			continue
+		}
+		available := hard.DeepCopy()
+		if used, ok := quota.Status.Used[name]; ok {
+			available.Sub(used)
+		}
+		if want.Cmp(available) > 0 {
+			violations = append(violations, fmt.Sprintf("%s %s needs %s but %s is available", quota.Name, name, want.String(), available.String()))
+		}
+	}
+	sort.Strings(violations)
+	return violations
+}
+
+// unreservedResources returns the allocatable cpu and memory of the node, less the requests of
+// the pods running on it
+func unreservedResources(node corev1.Node, pods []corev1.Pod) (resource.Quantity, resource.Quantity) {
+	cpu := node.Status.Allocatable.Cpu().DeepCopy()
+	memory := node.Status.Allocatable.Memory().DeepCopy()
+	for _, pod := range pods {
+		if pod.Spec.NodeName != node.Name || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		requests := podRequests(pod.Spec)
+		cpu.Sub(*requests.Cpu())
+		memory.Sub(*requests.Memory())
+	}
+	return cpu, memory
+}
+
+// podRequests returns the cpu and memory reserved for the pod by the scheduler, which is the
+// larger of the containers and the largest init container, plus the pod overhead. sidecar
+// init containers keep running, so they add to the containers and the later init containers
+func podRequests(spec corev1.PodSpec) corev1.ResourceList {
+	requests := corev1.ResourceList{}
+	for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+		var total, sidecars, initContainers resource.Quantity
+		for _, container := range spec.Containers {
+			total.Add(container.Resources.Requests[name])
+		}
+		for _, container := range spec.InitContainers {
+			request := container.Resources.Requests[name].DeepCopy()
+			if container.RestartPolicy != nil && *container.RestartPolicy == corev1.ContainerRestartPolicyAlways {
+				sidecars.Add(request)
+				request = sidecars.DeepCopy()
+			} else {
+				request.Add(sidecars)
+			}
+			if request.Cmp(initContainers) > 0 {
+				initContainers = request
+			}
+		}
+		total.Add(sidecars)
+		if initContainers.Cmp(total) > 0 {
+			total = initContainers
+		}
+		total.Add(spec.Overhead[name])
+		requests[name] = total
+	}
+	return requests
+}
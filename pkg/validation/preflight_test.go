@@ -0,0 +1,155 @@
+package validation
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	kubevirtv1 "kubevirt.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func Test_PlannedUsage(t *testing.T) {
+	assert := require.New(t)
+	objs := []client.Object{
+		&corev1.PersistentVolumeClaim{
+			Spec: corev1.PersistentVolumeClaimSpec{
+				StorageClassName: ptr.To("lvm"),
+				Resources: corev1.VolumeResourceRequirements{
+					Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("1Gi")},
+				},
+			},
+		},
+		&corev1.Pod{},
+		&kubevirtv1.VirtualMachine{
+			Spec: kubevirtv1.VirtualMachineSpec{
+				Template: &kubevirtv1.VirtualMachineInstanceTemplateSpec{
+					Spec: kubevirtv1.VirtualMachineInstanceSpec{
+						Domain: kubevirtv1.DomainSpec{
+							CPU:    &kubevirtv1.CPU{Sockets: 1, Threads: 1, Cores: 2},
+							Memory: &kubevirtv1.Memory{Guest: ptr.To(resource.MustParse("4Gi"))},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	usage := plannedUsage(objs, defaultCPUAllocation)
+	assert.Equal(int64(1), usage.Name(corev1.ResourcePersistentVolumeClaims, resource.DecimalSI).Value())
+	assert.Equal(int64(1), usage.Name("lvm.storageclass.storage.k8s.io/persistentvolumeclaims", resource.DecimalSI).Value())
+	assert.True(resource.MustParse("1Gi").Equal(usage[corev1.ResourceRequestsStorage]))
+	assert.Equal(int64(2), usage.Pods().Value())
+	assert.Equal(int64(1), usage.Name(vmCountQuotaResource, resource.DecimalSI).Value())
+	assert.Equal(int64(200), usage.Name(corev1.ResourceRequestsCPU, resource.DecimalSI).MilliValue())
+	assert.True(resource.MustParse("4Gi").Equal(usage[corev1.ResourceRequestsMemory]))
+}
+
+func Test_QuotaViolations(t *testing.T) {
+	assert := require.New(t)
+	quota := corev1.ResourceQuota{
+		ObjectMeta: metav1.ObjectMeta{Name: "quota"},
+		Status: corev1.ResourceQuotaStatus{
+			Hard: corev1.ResourceList{
+				corev1.ResourcePersistentVolumeClaims: resource.MustParse("10"),
+				corev1.ResourceRequestsStorage:        resource.MustParse("20Gi"),
+			},
+			Used: corev1.ResourceList{
+				corev1.ResourcePersistentVolumeClaims: resource.MustParse("8"),
+			},
+		},
+	}
+
+	planned := corev1.ResourceList{
+		corev1.ResourcePersistentVolumeClaims: resource.MustParse("2"),
+		corev1.ResourceRequestsStorage:        resource.MustParse("10Gi"),
+		corev1.ResourcePods:                   resource.MustParse("5"),
+	}
+	assert.Empty(quotaViolations(quota, planned))
+
+	planned[corev1.ResourcePersistentVolumeClaims] = resource.MustParse("3")
+	assert.Equal([]string{"quota persistentvolumeclaims needs 3 but 2 is available"}, quotaViolations(quota, planned))
+}
+
+func Test_UnreservedResources(t *testing.T) {
+	assert := require.New(t)
+	node := corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+		Status: corev1.NodeStatus{
+			Allocatable: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("4"),
+				corev1.ResourceMemory: resource.MustParse("8Gi"),
+			},
+		},
+	}
+	requests := corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("1"),
+			corev1.ResourceMemory: resource.MustParse("2Gi"),
+		},
+	}
+	pods := []corev1.Pod{
+		{Spec: corev1.PodSpec{NodeName: "node-1", Containers: []corev1.Container{{Resources: requests}}}},
+		{Spec: corev1.PodSpec{NodeName: "node-2", Containers: []corev1.Container{{Resources: requests}}}},
+		{
+			Spec:   corev1.PodSpec{NodeName: "node-1", Containers: []corev1.Container{{Resources: requests}}},
+			Status: corev1.PodStatus{Phase: corev1.PodSucceeded},
+		},
+	}
+
+	cpu, memory := unreservedResources(node, pods)
+	assert.True(resource.MustParse("3").Equal(cpu))
+	assert.True(resource.MustParse("6Gi").Equal(memory))
+
+	// the largest init container and the pod overhead are reserved too
+	initRequests := corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("2"),
+			corev1.ResourceMemory: resource.MustParse("1Gi"),
+		},
+	}
+	pods = append(pods, corev1.Pod{
+		Spec: corev1.PodSpec{
+			NodeName:       "node-1",
+			InitContainers: []corev1.Container{{Resources: initRequests}},
+			Containers:     []corev1.Container{{Resources: requests}},
+			Overhead: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("100m"),
+				corev1.ResourceMemory: resource.MustParse("256Mi"),
+			},
+		},
+	})
+	cpu, memory = unreservedResources(node, pods)
+	assert.True(resource.MustParse("900m").Equal(cpu))
+	assert.True(resource.MustParse("3840Mi").Equal(memory))
+}
+
+func Test_PodRequests(t *testing.T) {
+	assert := require.New(t)
+	container := func(cpu string, restartPolicy *corev1.ContainerRestartPolicy) corev1.Container {
+		return corev1.Container{
+			RestartPolicy: restartPolicy,
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse(cpu)},
+			},
+		}
+	}
+	always := ptr.To(corev1.ContainerRestartPolicyAlways)
+
+	requests := podRequests(corev1.PodSpec{
+		InitContainers: []corev1.Container{container("500m", nil), container("3", nil)},
+		Containers:     []corev1.Container{container("1", nil), container("1", nil)},
+	})
+	assert.True(resource.MustParse("3").Equal(*requests.Cpu()))
+	assert.True(requests.Memory().IsZero())
+
+	// sidecars run alongside the containers and the init containers started after them
+	requests = podRequests(corev1.PodSpec{
+		InitContainers: []corev1.Container{container("500m", always), container("2", nil)},
+		Containers:     []corev1.Container{container("1", nil)},
+	})
+	assert.True(resource.MustParse("2500m").Equal(*requests.Cpu()))
+}
@@ -0,0 +1,227 @@
+package validation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	kubevirtv1 "kubevirt.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/harvester/storage-validator/pkg/api"
+)
+
+const (
+	rwxDisk = "rwx-shared"
+	// rwxWriterSeconds is how long each writer pod appends to its file on the shared volume
+	rwxWriterSeconds = 30
+	// rwxWaitSeconds is how long each writer pod waits for the writes from other nodes, which
+	// allows for the pods starting at different times
+	rwxWaitSeconds = 300
+	// rwxCleanupTimeout bounds the removal of the peer vm and the shared disk, which runs
+	// after the check returns and may no longer use the context of the run
+	rwxCleanupTimeout = 2 * time.Minute
+	// rwxBlockSize is used for direct io to the shared block device, and is a multiple of
+	// the logical block size of any disk
+	rwxBlockSize = 4096
+)
+
+// runRWXMultiWriter ensures ReadWriteMany volumes from the storage class can be used from two
+// nodes at the same time. the baseline filesystem pvc is mounted by pods on two nodes writing
+// concurrently, and a block pvc is hot plugged to the validation vm and a second vm on another
+// node, with each side verifying it can read the data written by the other
+func (v *ValidationRun) runRWXMultiWriter(ctx context.Context) error {
+	vmNode, err := v.vmiNodeName(ctx)
+	if err != nil {
+		return err
+	}
+
+	nodes, err := v.schedulableNodes(ctx)
+	if err != nil {
+		return err
+	}
+	var peer *corev1.Node
+	for i := range nodes {
+		if nodes[i].Name != vmNode {
+			peer = &nodes[i]
+			break
+		}
+	}
+	if peer == nil {
+		return skipCheck("rwx multi writer check needs at least 2 schedulable nodes, found %d", len(nodes))
+	}
+
+	if err := v.verifyRWXFilesystem(ctx, []string{vmNode, peer.Name}); err != nil {
+		return err
+	}
+	return v.verifyRWXBlock(ctx, *peer)
+}
+
+// rwxTimeout returns the time added to the run timeout for the rwx multi writer check, which
+// covers the writer pods, or none when the storage class does not support ReadWriteMany
+func (v *ValidationRun) rwxTimeout() time.Duration {
+	if v.notApplicable([]string{api.FeatureRWX}) != "" {
+		return 0
+	}
+	return (rwxWriterSeconds + rwxWaitSeconds) * time.Second
+}
+
+// verifyRWXFilesystem runs a writer pod on each node mounting the baseline pvc. each pod appends
+// to its own file, then waits until the file of every other pod is complete
+func (v *ValidationRun) verifyRWXFilesystem(ctx context.Context, nodeNames []string) error {
+	var pods []*corev1.Pod
+	for _, nodeName := range nodeNames {
+		pod := v.newRWXWriterPod(nodeName, v.pvcName, nodeNames)
+		if err := v.clients.runtimeClient.Create(ctx, pod); err != nil {
+			return fmt.Errorf("error creating pod: %w", err)
+		}
+		v.createdObjects = append(v.createdObjects, pod)
+		pods = append(pods, pod)
+	}
+
+	var errs []error
+	for _, pod := range pods {
+		if err := v.waitUntilObjectIsReady(ctx, pod, verifyPodSucceeded); err != nil {
+			errs = append(errs, fmt.Errorf("rwx writer on node %s did not see the data written from other nodes: %w", pod.Spec.NodeName, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// verifyRWXBlock hot plugs a block pvc to the validation vm and to a second vm on the peer node.
+// each guest writes a token to its own block of the shared disk, and reads the token of the other
+func (v *ValidationRun) verifyRWXBlock(ctx context.Context, peer corev1.Node) error {
+	peerVM, _, err := v.bootVMFromImage(ctx, v.vmImageName, func(vmObj *kubevirtv1.VirtualMachine) {
+		vmObj.GenerateName = "vm-rwx-storage-validation-"
+		vmObj.Spec.Template.Spec.NodeSelector = map[string]string{corev1.LabelHostname: nodeHostname(peer)}
+	})
+	if peerVM != nil {
+		// the peer vm is removed once done, which also detaches the shared disk from it
+		defer func() {
+			cleanupCtx, cancel := context.WithTimeout(context.Background(), rwxCleanupTimeout)
+			defer cancel()
+			if err := v.clients.runtimeClient.Delete(cleanupCtx, peerVM); err != nil && !apierrors.IsNotFound(err) {
+				logrus.Errorf("error deleting vm %s: %v", peerVM.Name, err)
+			}
+		}()
+	}
+	if err != nil {
+		return err
+	}
+
+	disk := hotplugDisk{
+		name: rwxDisk,
+		bus:  kubevirtv1.DiskBusSCSI,
+		pvc:  v.newHotplugPVC(corev1.PersistentVolumeBlock),
+	}
+	if err := v.clients.runtimeClient.Create(ctx, disk.pvc); err != nil {
+		return fmt.Errorf("error creating pvc: %w", err)
+	}
+	v.createdObjects = append(v.createdObjects, disk.pvc)
+
+	vmNames := []string{v.vmName, peerVM.Name}
+	for _, vmName := range vmNames {
+		if err := v.clients.kubevirtClient.VirtualMachine(v.Configuration.Namespace).AddVolume(ctx, vmName, newAddVolumeOptions(disk.name, disk.pvc.Name, disk.bus)); err != nil {
+			return fmt.Errorf("error attempting to hot plug disk %s to vm %s: %w", disk.name, vmName, err)
+		}
+	}
+	defer func() {
+		cleanupCtx, cancel := context.WithTimeout(context.Background(), rwxCleanupTimeout)
+		defer cancel()
+		if err := v.unplugVolumes(cleanupCtx, []hotplugDisk{disk}); err != nil {
+			logrus.Errorf("error unplugging shared disk %s: %v", disk.name, err)
+		}
+	}()
+	for _, vmName := range vmNames {
+		if err := v.waitForHotplugVolumes(ctx, vmName, []string{disk.pvc.Name}); err != nil {
+			return err
+		}
+	}
+
+	tokens := make([]string, len(vmNames))
+	for i, vmName := range vmNames {
+		tokens[i] = randomToken()
+		if _, err := v.runInGuest(ctx, vmName, rwxBlockWriteCommand(tokens[i], i)); err != nil {
+			return fmt.Errorf("error writing to shared disk from vm %s: %w", vmName, err)
+		}
+	}
+
+	for i, vmName := range vmNames {
+		// each vm reads the block written by the other vm
+		other := (i + 1) % len(vmNames)
+		output, err := v.runInGuest(ctx, vmName, rwxBlockReadCommand(other))
+		if err != nil {
+			return fmt.Errorf("error reading shared disk from vm %s: %w", vmName, err)
+		}
+		if strings.TrimSpace(output) != tokens[other] {
+			return fmt.Errorf("vm %s did not see the data written to the shared disk by vm %s, expected %q, found %q", vmName, vmNames[other], tokens[other], strings.TrimSpace(output))
+		}
+	}
+	return nil
+}
+
+func (v *ValidationRun) planRunRWXMultiWriter() []client.Object {
+	objs := []client.Object{
+		v.newRWXWriterPod("", v.pvcName, nil),
+		v.newRWXWriterPod("", v.pvcName, nil),
+	}
+	objs = append(objs, v.planBootVMFromImage(v.vmImageName)...)
+	return append(objs, v.newHotplugPVC(corev1.PersistentVolumeBlock))
+}
+
+// runInGuest runs a command in a new session of the guest, and returns its output
+func (v *ValidationRun) runInGuest(ctx context.Context, vmName, command string) (string, error) {
+	guest, err := v.openGuestSession(ctx, vmName)
+	if err != nil {
+		return "", err
+	}
+	defer guest.close()
+	return guest.run(ctx, command)
+}
+
+// rwxDevice resolves the shared disk in the guest, which is discovered shortly after it is attached
+func rwxDevice() string {
+	return fmt.Sprintf("$(for i in $(seq 60); do ls /dev/disk/by-id/*%[1]s >/dev/null 2>&1 && break; sleep 1; done; readlink -f /dev/disk/by-id/*%[1]s)", rwxDisk)
+}
+
+func rwxBlockWriteCommand(token string, block int) string {
+	return fmt.Sprintf("printf %s | dd of=%s bs=%d seek=%d count=1 oflag=direct conv=sync,notrunc status=none", token, rwxDevice(), rwxBlockSize, block)
+}
+
+func rwxBlockReadCommand(block int) string {
+	return fmt.Sprintf("dd if=%s bs=%d skip=%d count=1 iflag=direct status=none | tr -d '\\000'", rwxDevice(), rwxBlockSize, block)
+}
+
+// newRWXWriterPod defines a pod on the node, which appends numbered lines to a file named after
+// its node on the shared volume while the pods on the other nodes do the same. the pod then waits
+// until it sees every line written from the other nodes, and fails if a write fails or lines are missing
+func (v *ValidationRun) newRWXWriterPod(nodeName, pvcName string, nodeNames []string) *corev1.Pod {
+	script := fmt.Sprintf(`f=%[1]s/rwx-%[2]s; rm -f $f; for i in $(seq %[3]d); do echo "%[2]s $i" >> $f && sync || exit 1; sleep 1; done`,
+		probeMountPath, nodeName, rwxWriterSeconds)
+	for _, other := range nodeNames {
+		if other == nodeName {
+			continue
+		}
+		script += fmt.Sprintf(`; f=%[1]s/rwx-%[2]s; for i in $(seq %[4]d); do [ "$(grep -cx '%[2]s [0-9]*' $f 2>/dev/null)" = %[3]d ] && break; sleep 1; done; [ "$(grep -cx '%[2]s [0-9]*' $f)" = %[3]d ]`,
+			probeMountPath, other, rwxWriterSeconds, rwxWaitSeconds)
+	}
+
+	pod := v.newProbePod("rwx-storage-validation-", pvcName)
+	pod.Spec.RestartPolicy = corev1.RestartPolicyNever
+	pod.Spec.NodeName = nodeName
+	pod.Spec.Containers[0].Command = []string{"sh", "-c", script}
+	return pod
+}
+
+// nodeHostname returns the hostname label of the node, used to pin workloads to it
+func nodeHostname(node corev1.Node) string {
+	if hostname, ok := node.Labels[corev1.LabelHostname]; ok {
+		return hostname
+	}
+	return node.Name
+}
@@ -0,0 +1,192 @@
+package validation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubevirtv1 "kubevirt.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/harvester/storage-validator/pkg/api"
+)
+
+// scaleVMTimeout is the time added to the run timeout for each vm of the scale check, as the vms
+// are cloned, imported and booted at the same time and contend for the same storage backend
+const scaleVMTimeout = time.Minute
+
+// scaleVMResult tracks the provisioning of a single vm of the scale check
+type scaleVMResult struct {
+	objects     []client.Object
+	vm          *kubevirtv1.VirtualMachine
+	volumeReady time.Duration
+	running     time.Duration
+	throttled   int
+	err         error
+}
+
+// createVirtualMachinesInParallel boots the configured number of vms from the vmimage at the
+// same time, to trigger the concurrent clones which are not exercised by booting a single vm.
+// the time taken for the boot volumes to be ready and the vms to be running is reported, and
+// the vms are removed once running, and are gone before subsequent checks use the same nodes
+func (v *ValidationRun) createVirtualMachinesInParallel(ctx context.Context) error {
+	count := v.Configuration.Scale.VMCount
+	if count <= 0 {
+		return skipCheck("scale check not enabled, set scale.vmCount to boot vms in parallel")
+	}
+
+	results := make([]scaleVMResult, count)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func(result *scaleVMResult) {
+			defer wg.Done()
+			v.provisionScaleVM(ctx, result)
+		}(&results[i])
+	}
+	wg.Wait()
+
+	report := &api.VMScaleResult{VMCount: count}
+	var volumeReady, running []time.Duration
+	for _, result := range results {
+		v.createdObjects = append(v.createdObjects, result.objects...)
+		report.ThrottledRequests += result.throttled
+		if result.err != nil {
+			report.Failed++
+			report.Failures = append(report.Failures, result.err.Error())
+			continue
+		}
+		report.Succeeded++
+		volumeReady = append(volumeReady, result.volumeReady)
+		running = append(running, result.running)
+	}
+	report.VolumeReadySeconds = summariseDurations(volumeReady)
+	report.RunningSeconds = summariseDurations(running)
+	v.Report.VMScale = report
+
+	var errs []error
+	for _, result := range results {
+		if result.vm == nil {
+			continue
+		}
+		vmi := &kubevirtv1.VirtualMachineInstance{ObjectMeta: metav1.ObjectMeta{Name: result.vm.Name, Namespace: result.vm.Namespace}}
+		if err := v.deleteAndWait(ctx, result.vm, vmi); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	logrus.Infof("booted %d of %d vms in parallel, running after p50 %.0fs max %.0fs", report.Succeeded, count, report.RunningSeconds.P50, report.RunningSeconds.Max)
+	if report.Failed > 0 {
+		errs = append([]error{fmt.Errorf("%d of %d vms booted in parallel failed, first failure: %s", report.Failed, count, report.Failures[0])}, errs...)
+	}
+	return errors.Join(errs...)
+}
+
+// scaleTimeout returns the time added to the run timeout for the vms of the scale check
+func (v *ValidationRun) scaleTimeout() time.Duration {
+	return time.Duration(v.Configuration.Scale.VMCount) * scaleVMTimeout
+}
+
+func (v *ValidationRun) planCreateVirtualMachinesInParallel() []client.Object {
+	var objs []client.Object
+	for i := 0; i < v.Configuration.Scale.VMCount; i++ {
+		objs = append(objs, v.planBootVMFromImage(v.vmImageName)...)
+	}
+	return objs
+}
+
+// provisionScaleVM creates a boot volume and a vm using it without waiting in between,
+// and records when the volume becomes ready and when the vm is running
+func (v *ValidationRun) provisionScaleVM(ctx context.Context, result *scaleVMResult) {
+	start := time.Now()
+	var bootVolume client.Object
+	var verifyVolumeReady func(client.Object) (bool, error)
+	if v.IsLonghornV1Engine() {
+		bootVolume = v.newV1BootPVC(v.vmImageName)
+		verifyVolumeReady = verifyPVCIsBound
+	} else {
+		bootVolume = v.newBootDataVolume(v.vmImageName)
+		verifyVolumeReady = verifyDataVolumeReady
+	}
+
+	if result.err = v.createWithThrottleRetry(ctx, bootVolume, result); result.err != nil {
+		return
+	}
+	result.objects = append(result.objects, bootVolume)
+
+	vmObj := v.newVirtualMachine(bootVolume.GetName())
+	if !v.IsLonghornV1Engine() {
+		// referencing the datavolume ensures kubevirt waits for the clone to complete
+		vmObj.Spec.Template.Spec.Volumes[0].VolumeSource = kubevirtv1.VolumeSource{
+			DataVolume: &kubevirtv1.DataVolumeSource{Name: bootVolume.GetName()},
+		}
+	}
+	if result.err = v.createWithThrottleRetry(ctx, vmObj, result); result.err != nil {
+		return
+	}
+	result.objects = append(result.objects, vmObj)
+	result.vm = vmObj
+
+	if result.err = v.waitUntilObjectIsReady(ctx, bootVolume, verifyVolumeReady); result.err != nil {
+		return
+	}
+	result.volumeReady = time.Since(start)
+
+	if result.err = v.waitUntilObjectIsReady(ctx, vmObj, verifyVMIsRunning); result.err != nil {
+		return
+	}
+	result.running = time.Since(start)
+}
+
+// createWithThrottleRetry creates the object, retrying requests throttled by the apiserver
+// and counting them as a sign of the control plane struggling with the load
+func (v *ValidationRun) createWithThrottleRetry(ctx context.Context, obj client.Object, result *scaleVMResult) error {
+	backoff := newWaitBackoff()
+	for {
+		err := v.clients.runtimeClient.Create(ctx, obj)
+		if err == nil {
+			return nil
+		}
+		if !apierrors.IsTooManyRequests(err) {
+			return fmt.Errorf("error creating %s: %w", objectKind(obj), err)
+		}
+
+		result.throttled++
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("error creating %s: %w", objectKind(obj), err)
+		case <-time.After(backoff.Step()):
+		}
+	}
+}
+
+// summariseDurations returns the min, max and nearest rank percentiles of the durations
+func summariseDurations(durations []time.Duration) api.DurationStats {
+	if len(durations) == 0 {
+		return api.DurationStats{}
+	}
+
+	sorted := make([]float64, 0, len(durations))
+	for _, d := range durations {
+		sorted = append(sorted, math.Round(d.Seconds()*10)/10)
+	}
+	sort.Float64s(sorted)
+
+	percentile := func(p float64) float64 {
+		rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+		return sorted[max(rank, 0)]
+	}
+	return api.DurationStats{
+		Min: sorted[0],
+		P50: percentile(50),
+		P90: percentile(90),
+		Max: sorted[len(sorted)-1],
+	}
+}
@@ -0,0 +1,21 @@
+package validation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/harvester/storage-validator/pkg/api"
+)
+
+func Test_SummariseDurations(t *testing.T) {
+	assert := require.New(t)
+	var durations []time.Duration
+	for i := 10; i >= 1; i-- {
+		durations = append(durations, time.Duration(i)*time.Second)
+	}
+
+	assert.Equal(api.DurationStats{Min: 1, P50: 5, P90: 9, Max: 10}, summariseDurations(durations))
+	assert.Equal(api.DurationStats{}, summariseDurations(nil))
+}
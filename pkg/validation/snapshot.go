@@ -11,18 +11,7 @@ import (
 )
 
 func (v *ValidationRun) createSnapshot(ctx context.Context) error {
-	volumeSnapshot := &snapshot.VolumeSnapshot{
-		ObjectMeta: metav1.ObjectMeta{
-			GenerateName: "snapshot-storage-validation-",
-			Namespace:    v.Configuration.Namespace,
-		},
-		Spec: snapshot.VolumeSnapshotSpec{
-			Source: snapshot.VolumeSnapshotSource{
-				PersistentVolumeClaimName: ptr.To(v.pvcName),
-			},
-			VolumeSnapshotClassName: ptr.To(v.Configuration.SnapshotClass),
-		},
-	}
+	volumeSnapshot := v.newVolumeSnapshot(v.pvcName)
 
 	err := v.clients.runtimeClient.Create(ctx, volumeSnapshot)
 	if err != nil {
@@ -31,21 +20,42 @@ func (v *ValidationRun) createSnapshot(ctx context.Context) error {
 
 	v.createdObjects = append(v.createdObjects, volumeSnapshot)
 
-	verifySnapshotIsReady := func(obj client.Object) (bool, error) {
-		snapshotObj, ok := obj.(*snapshot.VolumeSnapshot)
-		if !ok {
-			return false, fmt.Errorf("error asserting object %v to volumesnapshot", client.ObjectKeyFromObject(obj))
-		}
-
-		if snapshotObj.Status != nil && snapshotObj.Status.ReadyToUse != nil && *snapshotObj.Status.ReadyToUse {
-			return true, nil
-		}
-		return false, nil
-	}
-
 	if err := v.waitUntilObjectIsReady(ctx, volumeSnapshot, verifySnapshotIsReady); err != nil {
 		return err
 	}
 
 	return nil
 }
+
+// verify snapshot is ready to use
+func verifySnapshotIsReady(obj client.Object) (bool, error) {
+	snapshotObj, ok := obj.(*snapshot.VolumeSnapshot)
+	if !ok {
+		return false, fmt.Errorf("error asserting object %v to volumesnapshot", client.ObjectKeyFromObject(obj))
+	}
+
+	if snapshotObj.Status != nil && snapshotObj.Status.ReadyToUse != nil && *snapshotObj.Status.ReadyToUse {
+		return true, nil
+	}
+	return false, nil
+}
+
+func (v *ValidationRun) planCreateSnapshot() []client.Object {
+	return []client.Object{v.newVolumeSnapshot(v.pvcName)}
+}
+
+// newVolumeSnapshot defines a snapshot of the pvc using the snapshot class under validation
+func (v *ValidationRun) newVolumeSnapshot(pvcName string) *snapshot.VolumeSnapshot {
+	return &snapshot.VolumeSnapshot{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "snapshot-storage-validation-",
+			Namespace:    v.Configuration.Namespace,
+		},
+		Spec: snapshot.VolumeSnapshotSpec{
+			Source: snapshot.VolumeSnapshotSource{
+				PersistentVolumeClaimName: ptr.To(pvcName),
+			},
+			VolumeSnapshotClassName: ptr.To(v.Configuration.SnapshotClass),
+		},
+	}
+}
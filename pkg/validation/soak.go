@@ -0,0 +1,297 @@
+package validation
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	snapshot "github.com/kubernetes-csi/external-snapshotter/client/v4/apis/volumesnapshot/v1"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/harvester/storage-validator/pkg/api"
+)
+
+const (
+	SoakOperationMigration = "migration"
+	SoakOperationHotplug   = "hotplug"
+	SoakOperationSnapshot  = "snapshot"
+	SoakOperationStopStart = "stopStart"
+)
+
+// soakIterationTimeout is the time allowed for each iteration of the soak check when it is
+// configured by iterations rather than duration
+const soakIterationTimeout = 5 * time.Minute
+
+// soakOperations lists the operations supported by the soak check in the default order
+var soakOperations = []string{SoakOperationMigration, SoakOperationHotplug, SoakOperationSnapshot, SoakOperationStopStart}
+
+type soakOperationFunc func(ctx context.Context, iteration int) error
+
+// runSoak repeats the configured vm lifecycle operations for the configured duration or number
+// of iterations. failed operations do not stop the soak, so intermittent failures are counted
+// across iterations. storage resources in the cluster are counted before the first iteration
+// and after every iteration, and any growth over the soak is reported as a leak
+func (v *ValidationRun) runSoak(ctx context.Context) error {
+	soak := v.Configuration.Soak
+	if soak.Duration <= 0 && soak.Iterations <= 0 {
+		return skipCheck("soak check not enabled, set soak.duration or soak.iterations to repeat vm lifecycle operations")
+	}
+
+	operations := map[string]soakOperationFunc{
+		SoakOperationMigration: func(ctx context.Context, _ int) error { return v.migrateVMWithVolumes(ctx) },
+		SoakOperationHotplug: func(ctx context.Context, i int) error {
+			return v.hotplugAndUnplug(ctx, fmt.Sprintf("soak-%d", i))
+		},
+		SoakOperationSnapshot: v.soakSnapshot,
+		SoakOperationStopStart: func(ctx context.Context, _ int) error {
+			if err := v.stopVM(ctx); err != nil {
+				return err
+			}
+			return v.startVM(ctx)
+		},
+	}
+	selected, notApplicable, err := v.selectedSoakOperations()
+	if err != nil {
+		return err
+	}
+	for name, reason := range notApplicable {
+		logrus.Warnf("soak operation %s not applicable: %s", name, reason)
+	}
+	if len(selected) == 0 {
+		return skipCheck("none of the soak operations %s are applicable", strings.Join(soak.Operations, ", "))
+	}
+
+	result := &api.SoakResult{Operations: map[string]api.SoakOperationStats{}}
+	v.Report.Soak = result
+	durations := map[string][]time.Duration{}
+	var failures int
+
+	baseline, err := v.countStorageResources(ctx)
+	if err != nil {
+		return fmt.Errorf("error counting storage resources before the soak: %w", err)
+	}
+
+	start := time.Now()
+	for i := 1; ctx.Err() == nil; i++ {
+		if soak.Iterations > 0 && i > soak.Iterations {
+			break
+		}
+		if soak.Duration > 0 && time.Since(start) >= time.Duration(soak.Duration)*time.Second {
+			break
+		}
+
+		iteration := api.SoakIteration{Iteration: i}
+		for _, name := range selected {
+			opStart := time.Now()
+			err := operations[name](ctx, i)
+			elapsed := time.Since(opStart)
+
+			opResult := api.SoakOperationResult{
+				Name:            name,
+				Status:          api.CheckStatusSuccess,
+				DurationSeconds: elapsed.Round(time.Second).Seconds(),
+			}
+			stats := result.Operations[name]
+			if err != nil {
+				opResult.Status = api.CheckStatusFailure
+				opResult.Info = err.Error()
+				stats.Failed++
+				failures++
+				logrus.Errorf("soak iteration %d: %s failed: %v", i, name, err)
+			} else {
+				stats.Succeeded++
+				durations[name] = append(durations[name], elapsed)
+			}
+			result.Operations[name] = stats
+			iteration.Operations = append(iteration.Operations, opResult)
+		}
+
+		resources, err := v.countStorageResources(ctx)
+		if err != nil {
+			logrus.Warnf("soak iteration %d: %v", i, err)
+		}
+		iteration.Resources = resources
+
+		result.IterationResults = append(result.IterationResults, iteration)
+		result.Iterations = i
+		logrus.Infof("soak iteration %d completed, %d operations failed so far", i, failures)
+	}
+	result.DurationSeconds = time.Since(start).Round(time.Second).Seconds()
+
+	for name, stats := range result.Operations {
+		stats.Seconds = summariseDurations(durations[name])
+		result.Operations[name] = stats
+	}
+
+	if len(result.IterationResults) > 0 {
+		result.Leaks = detectLeaks(baseline, result.IterationResults[len(result.IterationResults)-1].Resources)
+	}
+
+	var errs []string
+	if failures > 0 {
+		errs = append(errs, fmt.Sprintf("%d soak operations failed over %d iterations", failures, result.Iterations))
+	}
+	if len(result.Leaks) > 0 {
+		errs = append(errs, fmt.Sprintf("storage resources leaked: %s", strings.Join(result.Leaks, ", ")))
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// selectedSoakOperations returns the configured soak operations in order, leaving out operations
+// depending on features the storage class does not support, which are returned with the reason
+func (v *ValidationRun) selectedSoakOperations() ([]string, map[string]string, error) {
+	requires := map[string]string{
+		SoakOperationMigration: api.FeatureRWX,
+		SoakOperationSnapshot:  api.FeatureSnapshot,
+	}
+	var selected []string
+	notApplicable := map[string]string{}
+	for _, name := range v.Configuration.Soak.Operations {
+		if !slices.Contains(soakOperations, name) {
+			return nil, nil, fmt.Errorf("unsupported soak operation %s, supported operations are %s", name, strings.Join(soakOperations, ", "))
+		}
+		if reason := v.notApplicable([]string{requires[name]}); reason != "" {
+			notApplicable[name] = reason
+			continue
+		}
+		selected = append(selected, name)
+	}
+	return selected, notApplicable, nil
+}
+
+// planRunSoak renders the objects created by a single iteration of the soak, which are
+// created again in every iteration
+func (v *ValidationRun) planRunSoak() []client.Object {
+	soak := v.Configuration.Soak
+	if soak.Duration <= 0 && soak.Iterations <= 0 {
+		return nil
+	}
+	selected, _, err := v.selectedSoakOperations()
+	if err != nil {
+		return nil
+	}
+
+	var objs []client.Object
+	for _, name := range selected {
+		switch name {
+		case SoakOperationMigration:
+			objs = append(objs, v.newVMMigration())
+		case SoakOperationHotplug:
+			objs = append(objs, v.newHotplugPVC(corev1.PersistentVolumeBlock))
+		case SoakOperationSnapshot:
+			objs = append(objs, v.newVolumeSnapshot(v.pvcName))
+		}
+	}
+	return objs
+}
+
+// soakTimeout returns the time added to the run timeout for the soak check, which is the
+// configured duration, or an allowance per iteration when only iterations are configured
+func (v *ValidationRun) soakTimeout() time.Duration {
+	soak := v.Configuration.Soak
+	if soak.Duration > 0 {
+		return time.Duration(soak.Duration) * time.Second
+	}
+	return time.Duration(soak.Iterations) * soakIterationTimeout
+}
+
+// soakSnapshot snapshots the baseline pvc, and removes the snapshot once it is ready
+func (v *ValidationRun) soakSnapshot(ctx context.Context, _ int) error {
+	volumeSnapshot := v.newVolumeSnapshot(v.pvcName)
+	if err := v.clients.runtimeClient.Create(ctx, volumeSnapshot); err != nil {
+		return fmt.Errorf("error creating volumesnapshot: %w", err)
+	}
+	v.createdObjects = append(v.createdObjects, volumeSnapshot)
+
+	if err := v.waitUntilObjectIsReady(ctx, volumeSnapshot, verifySnapshotIsReady); err != nil {
+		return err
+	}
+	return v.deleteAndWait(ctx, volumeSnapshot)
+}
+
+// deleteAndWait deletes the first object, and waits until all objects are removed
+func (v *ValidationRun) deleteAndWait(ctx context.Context, obj client.Object, dependents ...client.Object) error {
+	if err := v.clients.runtimeClient.Delete(ctx, obj); err != nil {
+		return fmt.Errorf("error deleting %s %s: %w", objectKind(obj), obj.GetName(), err)
+	}
+
+	for _, o := range append([]client.Object{obj}, dependents...) {
+		if o.GetName() == "" {
+			continue
+		}
+		if err := v.waitUntilObjectIsDeleted(ctx, o); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// countStorageResources counts the storage resources associated with the storage and snapshot
+// classes under validation, along with the pods in the validation namespace which have not completed
+func (v *ValidationRun) countStorageResources(ctx context.Context) (map[string]int, error) {
+	counts := map[string]int{}
+
+	attachmentList := &storagev1.VolumeAttachmentList{}
+	if err := v.clients.runtimeClient.List(ctx, attachmentList); err != nil {
+		return counts, fmt.Errorf("error listing volumeattachments: %w", err)
+	}
+	for _, attachment := range attachmentList.Items {
+		if attachment.Spec.Attacher == v.storageClass.Provisioner {
+			counts["volumeAttachments"]++
+		}
+	}
+
+	pvList := &corev1.PersistentVolumeList{}
+	if err := v.clients.runtimeClient.List(ctx, pvList); err != nil {
+		return counts, fmt.Errorf("error listing persistentvolumes: %w", err)
+	}
+	for _, pv := range pvList.Items {
+		if pv.Spec.StorageClassName == v.Configuration.StorageClass {
+			counts["persistentVolumes"]++
+		}
+	}
+
+	contentList := &snapshot.VolumeSnapshotContentList{}
+	if err := v.clients.runtimeClient.List(ctx, contentList); err != nil {
+		return counts, fmt.Errorf("error listing volumesnapshotcontents: %w", err)
+	}
+	for _, content := range contentList.Items {
+		if content.Spec.VolumeSnapshotClassName != nil && *content.Spec.VolumeSnapshotClassName == v.Configuration.SnapshotClass {
+			counts["volumeSnapshotContents"]++
+		}
+	}
+
+	podList := &corev1.PodList{}
+	if err := v.clients.runtimeClient.List(ctx, podList, client.InNamespace(v.Configuration.Namespace)); err != nil {
+		return counts, fmt.Errorf("error listing pods: %w", err)
+	}
+	// completed pods such as the source virt-launcher pod of a live migration are left
+	// behind until the vm is removed, and only running pods hold on to volumes
+	for _, pod := range podList.Items {
+		if pod.Status.Phase != corev1.PodSucceeded && pod.Status.Phase != corev1.PodFailed {
+			counts["pods"]++
+		}
+	}
+	return counts, nil
+}
+
+// detectLeaks reports resources which grew in number since the baseline
+func detectLeaks(baseline, current map[string]int) []string {
+	var leaks []string
+	for name, count := range current {
+		if count > baseline[name] {
+			leaks = append(leaks, fmt.Sprintf("%s increased from %d to %d", name, baseline[name], count))
+		}
+	}
+	sort.Strings(leaks)
+	return leaks
+}
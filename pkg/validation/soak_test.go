@@ -0,0 +1,67 @@
+package validation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	kubevirtv1 "kubevirt.io/api/core/v1"
+
+	"github.com/harvester/storage-validator/pkg/api"
+)
+
+func Test_DetectLeaks(t *testing.T) {
+	assert := require.New(t)
+	baseline := map[string]int{
+		"volumeAttachments": 2,
+		"persistentVolumes": 3,
+		"pods":              4,
+	}
+	current := map[string]int{
+		"volumeAttachments":      3,
+		"persistentVolumes":      3,
+		"pods":                   2,
+		"volumeSnapshotContents": 1,
+	}
+
+	leaks := detectLeaks(baseline, current)
+	assert.Equal([]string{
+		"volumeAttachments increased from 2 to 3",
+		"volumeSnapshotContents increased from 0 to 1",
+	}, leaks)
+	assert.Empty(detectLeaks(current, current))
+}
+
+func Test_SoakTimeout(t *testing.T) {
+	assert := require.New(t)
+	v := &ValidationRun{Configuration: &api.Configuration{}}
+	assert.Zero(v.soakTimeout())
+
+	v.Configuration.Soak.Iterations = 3
+	assert.Equal(3*soakIterationTimeout, v.soakTimeout())
+
+	v.Configuration.Soak.Duration = 600
+	assert.Equal(10*time.Minute, v.soakTimeout())
+}
+
+func Test_PlanRunSoak(t *testing.T) {
+	assert := require.New(t)
+	v := &ValidationRun{
+		Configuration: &api.Configuration{
+			Namespace: "default",
+			Soak:      api.SoakSpec{Operations: soakOperations},
+		},
+		unsupported: map[string]string{api.FeatureSnapshot: "no volumesnapshotclass found"},
+	}
+	assert.Empty(v.planRunSoak())
+
+	v.Configuration.Soak.Iterations = 3
+	objs := v.planRunSoak()
+	assert.Len(objs, 2)
+	assert.IsType(&kubevirtv1.VirtualMachineInstanceMigration{}, objs[0])
+	assert.IsType(&corev1.PersistentVolumeClaim{}, objs[1])
+
+	v.Configuration.Soak.Operations = []string{"reboot"}
+	assert.Empty(v.planRunSoak())
+}
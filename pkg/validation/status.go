@@ -0,0 +1,178 @@
+package validation
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	harvesterv1beta1 "github.com/harvester/harvester/pkg/apis/harvesterhci.io/v1beta1"
+	snapshot "github.com/kubernetes-csi/external-snapshotter/client/v4/apis/volumesnapshot/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubevirtv1 "kubevirt.io/api/core/v1"
+	cdiv1 "kubevirt.io/containerized-data-importer-api/pkg/apis/core/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// objectKind returns a short human readable kind for an object
+func objectKind(obj client.Object) string {
+	switch obj.(type) {
+	case *corev1.PersistentVolumeClaim:
+		return "PVC"
+	case *corev1.PersistentVolume:
+		return "PV"
+	case *kubevirtv1.VirtualMachine:
+		return "VM"
+	case *kubevirtv1.VirtualMachineInstance:
+		return "VMI"
+	case *kubevirtv1.VirtualMachineInstanceMigration:
+		return "VMIM"
+	case *harvesterv1beta1.VirtualMachineImage:
+		return "VMImage"
+	}
+
+	gvk, err := apiutil.GVKForObject(obj, scheme)
+	if err != nil {
+		return fmt.Sprintf("%T", obj)
+	}
+	return gvk.Kind
+}
+
+// describeObjectStatus summarises the observed phase and conditions of an object
+func describeObjectStatus(obj client.Object) string {
+	var details []string
+	switch o := obj.(type) {
+	case *corev1.PersistentVolumeClaim:
+		details = append(details, string(o.Status.Phase))
+		for _, cond := range o.Status.Conditions {
+			details = append(details, formatCondition(string(cond.Type), cond.Status, cond.Reason, cond.Message))
+		}
+	case *corev1.PersistentVolume:
+		details = append(details, string(o.Status.Phase), o.Status.Message)
+	case *corev1.Pod:
+		details = append(details, string(o.Status.Phase))
+		for _, cond := range o.Status.Conditions {
+			if cond.Status != corev1.ConditionTrue {
+				details = append(details, formatCondition(string(cond.Type), cond.Status, cond.Reason, cond.Message))
+			}
+		}
+		for _, status := range o.Status.ContainerStatuses {
+			if status.State.Waiting != nil {
+				details = append(details, fmt.Sprintf("container %s waiting: %s %s", status.Name, status.State.Waiting.Reason, status.State.Waiting.Message))
+			}
+		}
+	case *snapshot.VolumeSnapshot:
+		if o.Status == nil {
+			details = append(details, "no status reported")
+			break
+		}
+		details = append(details, fmt.Sprintf("readyToUse=%t", o.Status.ReadyToUse != nil && *o.Status.ReadyToUse))
+		if o.Status.Error != nil && o.Status.Error.Message != nil {
+			details = append(details, *o.Status.Error.Message)
+		}
+	case *harvesterv1beta1.VirtualMachineImage:
+		details = append(details, fmt.Sprintf("progress=%d%%", o.Status.Progress))
+		for _, cond := range o.Status.Conditions {
+			details = append(details, formatCondition(string(cond.Type), cond.Status, cond.Reason, cond.Message))
+		}
+	case *cdiv1.DataVolume:
+		details = append(details, string(o.Status.Phase), fmt.Sprintf("progress=%s", o.Status.Progress))
+		for _, cond := range o.Status.Conditions {
+			if cond.Status != corev1.ConditionTrue {
+				details = append(details, formatCondition(string(cond.Type), cond.Status, cond.Reason, cond.Message))
+			}
+		}
+	case *kubevirtv1.VirtualMachine:
+		details = append(details, string(o.Status.PrintableStatus))
+		for _, cond := range o.Status.Conditions {
+			if cond.Type == kubevirtv1.VirtualMachineFailure || cond.Type == kubevirtv1.VirtualMachineReady {
+				details = append(details, formatCondition(string(cond.Type), cond.Status, cond.Reason, cond.Message))
+			}
+		}
+	case *kubevirtv1.VirtualMachineInstance:
+		details = append(details, string(o.Status.Phase))
+		if o.Status.NodeName != "" {
+			details = append(details, fmt.Sprintf("node=%s", o.Status.NodeName))
+		}
+		for _, volumeStatus := range o.Status.VolumeStatus {
+			if volumeStatus.Phase != "" {
+				details = append(details, fmt.Sprintf("volume %s %s %s", volumeStatus.Name, volumeStatus.Phase, volumeStatus.Message))
+			}
+		}
+	case *kubevirtv1.VirtualMachineInstanceMigration:
+		details = append(details, string(o.Status.Phase))
+		if o.Status.MigrationState != nil && o.Status.MigrationState.FailureReason != "" {
+			details = append(details, o.Status.MigrationState.FailureReason)
+		}
+		for _, cond := range o.Status.Conditions {
+			details = append(details, formatCondition(string(cond.Type), cond.Status, cond.Reason, cond.Message))
+		}
+	}
+
+	var filtered []string
+	for _, detail := range details {
+		if detail = strings.TrimSpace(detail); detail != "" {
+			filtered = append(filtered, detail)
+		}
+	}
+
+	if len(filtered) == 0 {
+		return objectKind(obj)
+	}
+	return fmt.Sprintf("%s %s", objectKind(obj), strings.Join(filtered, ", "))
+}
+
+func formatCondition(condType string, status corev1.ConditionStatus, reason, message string) string {
+	condition := fmt.Sprintf("%s=%s", condType, status)
+	if reason != "" {
+		condition = fmt.Sprintf("%s (%s)", condition, reason)
+	}
+	if message != "" {
+		condition = fmt.Sprintf("%s %s", condition, message)
+	}
+	return condition
+}
+
+// warningEvents returns Warning events recorded against an object, newest first
+func (v *ValidationRun) warningEvents(ctx context.Context, obj client.Object) ([]corev1.Event, error) {
+	if obj.GetUID() == "" {
+		return nil, nil
+	}
+
+	// events for cluster scoped objects are recorded in the default namespace
+	namespace := obj.GetNamespace()
+	if namespace == "" {
+		namespace = metav1.NamespaceDefault
+	}
+
+	eventList := &corev1.EventList{}
+	err := v.clients.runtimeClient.List(ctx, eventList, client.InNamespace(namespace), client.MatchingFields{
+		"involvedObject.uid": string(obj.GetUID()),
+		"type":               corev1.EventTypeWarning,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing events for object %v: %w", client.ObjectKeyFromObject(obj), err)
+	}
+
+	events := eventList.Items
+	sort.Slice(events, func(i, j int) bool {
+		return eventTime(events[i]).After(eventTime(events[j]))
+	})
+	return events, nil
+}
+
+// eventTime returns the most recent time an event was observed
+func eventTime(event corev1.Event) time.Time {
+	switch {
+	case event.Series != nil:
+		return event.Series.LastObservedTime.Time
+	case !event.LastTimestamp.IsZero():
+		return event.LastTimestamp.Time
+	case !event.EventTime.IsZero():
+		return event.EventTime.Time
+	}
+	return event.CreationTimestamp.Time
+}
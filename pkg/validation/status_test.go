@@ -0,0 +1,50 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func Test_DescribeObjectStatus(t *testing.T) {
+	assert := require.New(t)
+	pvc := &corev1.PersistentVolumeClaim{
+		Status: corev1.PersistentVolumeClaimStatus{
+			Phase: corev1.ClaimPending,
+		},
+	}
+	assert.Equal("PVC Pending", describeObjectStatus(pvc))
+
+	pod := &corev1.Pod{
+		Status: corev1.PodStatus{
+			Phase: corev1.PodPending,
+			ContainerStatuses: []corev1.ContainerStatus{
+				{
+					Name: "nginx",
+					State: corev1.ContainerState{
+						Waiting: &corev1.ContainerStateWaiting{Reason: "ImagePullBackOff"},
+					},
+				},
+			},
+		},
+	}
+	assert.Equal("Pod Pending, container nginx waiting: ImagePullBackOff", describeObjectStatus(pod))
+}
+
+func Test_IsTransientError(t *testing.T) {
+	assert := require.New(t)
+	resource := schema.GroupResource{Resource: "pods"}
+	assert.True(isTransientError(apierrors.NewTooManyRequests("throttled", 1)))
+	assert.True(isTransientError(apierrors.NewServerTimeout(resource, "get", 1)))
+	assert.True(isTransientError(apierrors.NewResourceExpired("too old resource version")))
+	assert.True(isTransientError(fmt.Errorf("error getting object: %w", &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED})))
+	assert.False(isTransientError(apierrors.NewForbidden(resource, "pod", errors.New("denied"))))
+	assert.False(isTransientError(errors.New("pod probe failed: Pod Failed")))
+}
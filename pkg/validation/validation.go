@@ -2,9 +2,9 @@ package validation
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"os"
+	"strings"
 
 	harvesterv1beta1 "github.com/harvester/harvester/pkg/apis/harvesterhci.io/v1beta1"
 	snapshot "github.com/kubernetes-csi/external-snapshotter/client/v4/apis/volumesnapshot/v1"
@@ -20,6 +20,7 @@ import (
 	"github.com/harvester/storage-validator/pkg/api"
 
 	"github.com/rancher/wrangler/v3/pkg/signals"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/rest"
 	"kubevirt.io/client-go/kubecli"
@@ -33,6 +34,8 @@ const (
 
 type ValidationRun struct {
 	ConfigFile     string
+	DryRun         bool // render the planned checks and manifests without creating any objects
+	ListImages     bool // list container images needed by the run without running any checks
 	ctx            context.Context
 	Configuration  *api.Configuration
 	Report         *api.Report
@@ -42,13 +45,15 @@ type ValidationRun struct {
 	pvcName        string // used to track baseline pvc used for snapshots
 	vmImageName    string // used to track vmimage created for subsequent vm creation
 	vmName         string // used to track vm created for hot plug and snapshot operations
+	bootPVCName    string // used to track boot volume of the vm created for image export operations
 	storageClass   *storagev1.StorageClass
+	unsupported    map[string]string // features not supported by the storage class, with the reason
 	Version        string
 }
 
 type HarvesterClient struct {
 	kubevirtClient kubecli.KubevirtClient
-	runtimeClient  client.Client
+	runtimeClient  client.WithWatch
 }
 
 func init() {
@@ -56,6 +61,7 @@ func init() {
 	utilruntime.Must(snapshot.AddToScheme(scheme))
 	utilruntime.Must(storagev1.AddToScheme(scheme))
 	utilruntime.Must(corev1.AddToScheme(scheme))
+	utilruntime.Must(appsv1.AddToScheme(scheme))
 	utilruntime.Must(harvesterv1beta1.AddToScheme(scheme))
 	utilruntime.Must(cdiv1.AddToScheme(scheme))
 	utilruntime.Must(kubevirtv1.AddToScheme(scheme))
@@ -74,9 +80,13 @@ func (v *ValidationRun) Execute() error {
 		return err
 	}
 
+	if v.ListImages {
+		return v.listImages(os.Stdout)
+	}
+
 	// initialise reporting structure
 	v.Report = &api.Report{
-		Configuration: *v.Configuration,
+		Configuration: redactConfiguration(*v.Configuration),
 	}
 
 	// generate k8s clients
@@ -84,9 +94,22 @@ func (v *ValidationRun) Execute() error {
 		return err
 	}
 
-	// run preflight checks
+	// apply systemwide defaults
+	if err := v.applyValidatinoDefaults(); err != nil {
+		return err
+	}
+
+	// identify features the storage class does not support, to skip dependent checks
+	if err := v.detectCapabilities(); err != nil {
+		return err
+	}
+
+	// run preflight checks, which need the defaults to size the planned objects
 	initiateCheck("preflight checks")
 	if err := v.preFlightChecks(); err != nil {
+		if printErr := v.printReport(); printErr != nil {
+			logrus.Errorf("error printing report: %v", printErr)
+		}
 		return err
 	}
 	completedCheck("preflight checks")
@@ -95,17 +118,36 @@ func (v *ValidationRun) Execute() error {
 	if err != nil {
 		return err
 	}
-
 	v.Report.EnvironmentInfo = envInfo
-	// apply systemwide defaults
-	if err := v.applyValidatinoDefaults(); err != nil {
-		return err
+
+	if v.DryRun {
+		// render the url the local image file would be served at, without serving it
+		if v.Configuration.ImageFile != "" {
+			if err := v.planImageFileURL(); err != nil {
+				return err
+			}
+		}
+		return v.renderPlan(os.Stdout)
+	}
+
+	// serve local image file for the duration of the run
+	if v.Configuration.ImageFile != "" {
+		stop, err := v.serveImageFile()
+		if err != nil {
+			return err
+		}
+		defer stop()
 	}
 
 	if err := v.runChecks(); err != nil {
 		logrus.Errorf("validation failed with error: %v", err)
 	}
 
+	return v.printReport()
+}
+
+// printReport writes the report of the run to stdout
+func (v *ValidationRun) printReport() error {
 	resultByte, err := yaml.Marshal(v.Report)
 	if err != nil {
 		return fmt.Errorf("err marshalling result data: %w", err)
@@ -132,28 +174,16 @@ func (v *ValidationRun) readConfig() error {
 	return nil
 }
 
-// running preflight checks
-func (v *ValidationRun) preFlightChecks() error {
-	if v.Configuration.ImageURL == "" {
-		return errors.New("no imageURL specified, aborting run")
-	}
-
-	nodeList := &corev1.NodeList{}
-	if err := v.clients.runtimeClient.List(v.ctx, nodeList); err != nil {
-		return fmt.Errorf("error listing nodes during pre-flight checks: %w", err)
+// redactConfiguration masks secrets in a copy of the configuration, which is printed in
+// the report and the dry run output
+func redactConfiguration(config api.Configuration) api.Configuration {
+	if config.VMConfig.GuestPassword != "" {
+		config.VMConfig.GuestPassword = redactedValue
 	}
-
-	count := 0
-	for _, node := range nodeList.Items {
-		if node.DeletionTimestamp == nil && isNodeReady(node) {
-			count++
-		}
-	}
-
-	if count < 2 {
-		return errors.New("cluster does not have atleast 2 nodes, aborting run")
+	if config.ImageSources.HarvesterToken != "" {
+		config.ImageSources.HarvesterToken = redactedValue
 	}
-	return nil
+	return config
 }
 
 // ApplyDefaults will apply sane defaults for the storage validation configuration
@@ -186,6 +216,28 @@ func (v *ValidationRun) applyValidatinoDefaults() error {
 		v.Configuration.VMConfig.DiskSize = DefaultDiskSize
 	}
 
+	if len(v.Configuration.Hotplug.Buses) == 0 {
+		v.Configuration.Hotplug.Buses = []string{string(kubevirtv1.DiskBusSCSI), string(kubevirtv1.DiskBusVirtio)}
+	}
+
+	if v.Configuration.Hotplug.AttachTimeout == 0 {
+		v.Configuration.Hotplug.AttachTimeout = DefaultAttachTimeout
+	}
+
+	if len(v.Configuration.Soak.Operations) == 0 {
+		v.Configuration.Soak.Operations = soakOperations
+	}
+
+	if v.Configuration.VMConfig.GuestUser == "" {
+		v.Configuration.VMConfig.GuestUser = DefaultGuestUser
+	}
+
+	if v.Configuration.VMConfig.GuestPassword == "" {
+		v.Configuration.VMConfig.GuestPassword = randomToken()
+	}
+
+	v.applyWorkloadDefaults()
+
 	// verify and apply default storageClass if one is not present
 	if v.Configuration.StorageClass == "" {
 		logrus.Warnf("no default storage class specified, looking up default storageclass")
@@ -209,30 +261,42 @@ func (v *ValidationRun) applyValidatinoDefaults() error {
 		v.storageClass = scObj
 	}
 
-	// verify if there is no snapshot class if one can be identified from
-	// the underlying cdi storage profile
+	// identify the snapshot class from the underlying cdi storage profile if one is not
+	// specified. snapshot checks are marked not-applicable when none can be identified
 	if v.Configuration.SnapshotClass == "" {
-		storageProfileList := &cdiv1.StorageProfileList{}
-		err := v.clients.runtimeClient.List(v.ctx, storageProfileList)
+		profile, err := v.storageProfile()
 		if err != nil {
-			return fmt.Errorf("error listing cdi storageprofiles: %w", err)
+			return err
 		}
-		var found bool
-		for _, profile := range storageProfileList.Items {
-			if profile.Status.StorageClass != nil && *profile.Status.StorageClass == v.Configuration.StorageClass {
-				found = true
-				v.Configuration.SnapshotClass = *profile.Status.SnapshotClass
-			}
-		}
-
-		if !found {
-			return fmt.Errorf("no storageprofile matching storageclass %s found, no snapshot class specified, aborting check since snapshot based tests cannot be run", v.Configuration.StorageClass)
+		if profile != nil && profile.Status.SnapshotClass != nil {
+			v.Configuration.SnapshotClass = *profile.Status.SnapshotClass
+		} else {
+			logrus.Warnf("no snapshot class specified or found in the storageprofile of storageclass %s", v.Configuration.StorageClass)
 		}
 	}
 
 	return nil
 }
 
+// applyWorkloadDefaults applies defaults to the pods created by the validation,
+// which do not depend on any lookups against the cluster
+func (v *ValidationRun) applyWorkloadDefaults() {
+	if v.Configuration.Workload.Image == "" {
+		v.Configuration.Workload.Image = DefaultProbeImage
+	}
+
+	benchmark := &v.Configuration.Benchmark
+	if benchmark.Enabled && benchmark.Image != "" && !strings.Contains(benchmark.Image, "@sha256:") {
+		logrus.Warnf("benchmark.image %s is not pinned by digest, results may not be reproducible", benchmark.Image)
+	}
+	if benchmark.Size == "" {
+		benchmark.Size = DefaultBenchmarkSize
+	}
+	if benchmark.Runtime == 0 {
+		benchmark.Runtime = DefaultBenchmarkRuntime
+	}
+}
+
 func (v *ValidationRun) setupClients() error {
 	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
 	configOverrides := &clientcmd.ConfigOverrides{}
@@ -246,7 +310,7 @@ func (v *ValidationRun) setupClients() error {
 	if err != nil {
 		return fmt.Errorf("error generating kubevirt client: %w", err)
 	}
-	runtimeClient, err := client.New(cfg, client.Options{Scheme: scheme})
+	runtimeClient, err := client.NewWithWatch(cfg, client.Options{Scheme: scheme})
 	if err != nil {
 		return fmt.Errorf("error generating dynamic client interface: %w", err)
 	}
@@ -279,22 +343,3 @@ func (v *ValidationRun) IsLonghornV1Engine() bool {
 	}
 	return false
 }
-
-func (v *ValidationRun) fetchEnvironmentInfo() (api.EnvironmentInfo, error) {
-	envInfo := api.EnvironmentInfo{}
-	nodeList := &corev1.NodeList{}
-	if err := v.clients.runtimeClient.List(v.ctx, nodeList); err != nil {
-		return envInfo, fmt.Errorf("error listing nodes in cluster: %w", err)
-	}
-
-	envInfo.NodeCount = len(nodeList.Items)
-
-	setting := &harvesterv1beta1.Setting{}
-	if err := v.clients.runtimeClient.Get(v.ctx, types.NamespacedName{Name: ServerVersionSetting, Namespace: ""}, setting); err != nil {
-		return envInfo, fmt.Errorf("error fetching harvester version: %w", err)
-	}
-	envInfo.HarvesterVersion = setting.Value
-	envInfo.ValidatorVersion = v.Version
-
-	return envInfo, nil
-}
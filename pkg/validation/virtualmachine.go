@@ -15,25 +15,140 @@ import (
 )
 
 func (v *ValidationRun) createVirtualMachine(ctx context.Context) error {
+	vmObj, pvc, err := v.bootVMFromImage(ctx, v.vmImageName)
+	if vmObj != nil {
+		v.vmName = vmObj.Name // store VM Name as it will be used later for hot plug of volumes and snapshots
+		v.bootPVCName = pvc.Name
+	}
+	return err
+}
+
+// bootVMFromImage creates a boot volume from the vmimage and a vm using the same,
+// and waits until the vm is running. customize is applied to the vm before it is created
+func (v *ValidationRun) bootVMFromImage(ctx context.Context, imageName string, customize ...func(*kubevirtv1.VirtualMachine)) (*kubevirtv1.VirtualMachine, *corev1.PersistentVolumeClaim, error) {
 	pvc := &corev1.PersistentVolumeClaim{}
 	var err error
 	// when using longhornV1 Engine a storage class is created with same name as image
 	// and we can use that directly
 	if v.IsLonghornV1Engine() {
-		pvc, err = v.createV1PVC(ctx)
+		pvc, err = v.createV1PVC(ctx, imageName)
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
 	} else {
 		// CDI backed image, so we need to find golden pvc and use that
-		pvc, err = v.createDataVolume(ctx)
+		pvc, err = v.createDataVolume(ctx, imageName)
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
 	}
 
 	v.createdObjects = append(v.createdObjects, pvc)
 	// create a VM referencing the pvc returned from above
+	vmObj := v.newVirtualMachine(pvc.Name)
+	for _, fn := range customize {
+		fn(vmObj)
+	}
+
+	// create VM object
+	err = v.clients.runtimeClient.Create(ctx, vmObj)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating vm: %w", err)
+	}
+
+	v.createdObjects = append(v.createdObjects, vmObj)
+
+	// wait until VM is running
+	if err := v.waitUntilObjectIsReady(ctx, vmObj, verifyVMIsRunning); err != nil {
+		return vmObj, pvc, err
+	}
+
+	return vmObj, pvc, nil
+}
+
+// verify VM is running
+func verifyVMIsRunning(obj client.Object) (bool, error) {
+	vmObj, ok := obj.(*kubevirtv1.VirtualMachine)
+	if !ok {
+		return false, fmt.Errorf("error asserting object %v to vm", client.ObjectKeyFromObject(obj))
+	}
+	if vmObj.Status.PrintableStatus == kubevirtv1.VirtualMachineStatusRunning {
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func (v *ValidationRun) createV1PVC(ctx context.Context, imageName string) (*corev1.PersistentVolumeClaim, error) {
+	// define pvc for usage
+	pvc := v.newV1BootPVC(imageName)
+
+	err := v.clients.runtimeClient.Create(ctx, pvc)
+	if err != nil {
+		return nil, fmt.Errorf("error creating pvc for virtualmachine: %w", err)
+	}
+	return pvc, nil
+}
+
+// for non longhorn v1 engines we will create a datavolume from image volume
+// the pvc associated with datavolume is subsequently used to boot the vm
+func (v *ValidationRun) createDataVolume(ctx context.Context, imageName string) (*corev1.PersistentVolumeClaim, error) {
+	dvObj := v.newBootDataVolume(imageName)
+
+	// wait for datavolume to be marked ready
+	err := v.clients.runtimeClient.Create(ctx, dvObj)
+	if err != nil {
+		return nil, fmt.Errorf("error creating datavolume for vm: %w", err)
+	}
+
+	v.createdObjects = append(v.createdObjects, dvObj)
+
+	// wait until datavolume is ready
+	if err := v.waitUntilObjectIsReady(ctx, dvObj, verifyDataVolumeReady); err != nil {
+		return nil, err
+	}
+
+	pvcObj := &corev1.PersistentVolumeClaim{}
+	err = v.clients.runtimeClient.Get(ctx, types.NamespacedName{Name: dvObj.Name, Namespace: dvObj.Namespace}, pvcObj)
+	return pvcObj, err
+}
+
+// check if datavolume is ready
+func verifyDataVolumeReady(obj client.Object) (bool, error) {
+	dvObj, ok := obj.(*cdiv1.DataVolume)
+	if !ok {
+		return false, fmt.Errorf("error asserting object %v to datavolume", client.ObjectKeyFromObject(obj))
+	}
+
+	for _, condition := range dvObj.Status.Conditions {
+		if condition.Type == cdiv1.DataVolumeReady && condition.Status == corev1.ConditionTrue {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (v *ValidationRun) planCreateVirtualMachine() []client.Object {
+	objs := v.planBootVMFromImage(v.vmImageName)
+	v.bootPVCName = plannedName(objs[0])
+	v.vmName = plannedName(objs[1])
+	return objs
+}
+
+// planBootVMFromImage returns the boot volume and vm created by bootVMFromImage
+func (v *ValidationRun) planBootVMFromImage(imageName string) []client.Object {
+	var bootVolume client.Object
+	if v.IsLonghornV1Engine() {
+		bootVolume = v.newV1BootPVC(imageName)
+	} else {
+		bootVolume = v.newBootDataVolume(imageName)
+	}
+
+	return []client.Object{bootVolume, v.newVirtualMachine(plannedName(bootVolume))}
+}
+
+// newVirtualMachine defines the validation vm booting from the pvc
+func (v *ValidationRun) newVirtualMachine(pvcName string) *kubevirtv1.VirtualMachine {
 	vmObj := &kubevirtv1.VirtualMachine{
 		ObjectMeta: metav1.ObjectMeta{
 			GenerateName: "vm-storage-validation-",
@@ -43,6 +158,8 @@ func (v *ValidationRun) createVirtualMachine(ctx context.Context) error {
 			RunStrategy: ptr.To(kubevirtv1.RunStrategyRerunOnFailure),
 			Template: &kubevirtv1.VirtualMachineInstanceTemplateSpec{
 				Spec: kubevirtv1.VirtualMachineInstanceSpec{
+					// live migrate the vm when its node is drained, as harvester maintenance mode does
+					EvictionStrategy: ptr.To(kubevirtv1.EvictionStrategyLiveMigrate),
 					Domain: kubevirtv1.DomainSpec{
 						CPU: &kubevirtv1.CPU{
 							Sockets: 1,
@@ -63,6 +180,14 @@ func (v *ValidationRun) createVirtualMachine(ctx context.Context) error {
 									},
 									BootOrder: ptr.To(uint(1)),
 								},
+								{
+									Name: "cloudinit",
+									DiskDevice: kubevirtv1.DiskDevice{
+										Disk: &kubevirtv1.DiskTarget{
+											Bus: kubevirtv1.DiskBusVirtio,
+										},
+									},
+								},
 							},
 							Interfaces: []kubevirtv1.Interface{
 								{
@@ -81,11 +206,20 @@ func (v *ValidationRun) createVirtualMachine(ctx context.Context) error {
 							VolumeSource: kubevirtv1.VolumeSource{
 								PersistentVolumeClaim: &kubevirtv1.PersistentVolumeClaimVolumeSource{
 									PersistentVolumeClaimVolumeSource: corev1.PersistentVolumeClaimVolumeSource{
-										ClaimName: pvc.Name,
+										ClaimName: pvcName,
 									},
 								},
 							},
 						},
+						{
+							// sets the guest credentials used to run commands over the serial console
+							Name: "cloudinit",
+							VolumeSource: kubevirtv1.VolumeSource{
+								CloudInitNoCloud: &kubevirtv1.CloudInitNoCloudSource{
+									UserData: v.guestUserData(),
+								},
+							},
+						},
 					},
 					Networks: []kubevirtv1.Network{
 						{
@@ -100,38 +234,12 @@ func (v *ValidationRun) createVirtualMachine(ctx context.Context) error {
 		},
 	}
 
-	// create VM object
-	err = v.clients.runtimeClient.Create(ctx, vmObj)
-	if err != nil {
-		return fmt.Errorf("error creating vm: %w", err)
-	}
-
-	v.createdObjects = append(v.createdObjects, vmObj)
-	v.vmName = vmObj.Name // store VM Name as it will be used later for hot plug of volumes and snapshots
-
-	// verify VM is running
-	checkVMStatus := func(obj client.Object) (bool, error) {
-		vmObj, ok := obj.(*kubevirtv1.VirtualMachine)
-		if !ok {
-			return false, fmt.Errorf("error asserting object %v to vm", client.ObjectKeyFromObject(obj))
-		}
-		if vmObj.Status.PrintableStatus == kubevirtv1.VirtualMachineStatusRunning {
-			return true, nil
-		}
-
-		return false, nil
-	}
-
-	// wait until VM is running
-	if err := v.waitUntilObjectIsReady(ctx, vmObj, checkVMStatus); err != nil {
-		return err
-	}
-
-	return nil
+	return vmObj
 }
 
-func (v *ValidationRun) createV1PVC(ctx context.Context) (*corev1.PersistentVolumeClaim, error) {
-	// define pvc for usage
+// newV1BootPVC defines a boot pvc using the storage class created by
+// longhorn for the backing image of the vmimage
+func (v *ValidationRun) newV1BootPVC(imageName string) *corev1.PersistentVolumeClaim {
 	pvc := &corev1.PersistentVolumeClaim{
 		ObjectMeta: metav1.ObjectMeta{
 			GenerateName: "vm-storage-validation-",
@@ -144,21 +252,16 @@ func (v *ValidationRun) createV1PVC(ctx context.Context) (*corev1.PersistentVolu
 					corev1.ResourceStorage: resource.MustParse(v.Configuration.VMConfig.DiskSize),
 				},
 			},
-			StorageClassName: ptr.To(fmt.Sprintf("longhorn-%s", v.vmImageName)),
+			StorageClassName: ptr.To(fmt.Sprintf("longhorn-%s", imageName)),
 			VolumeMode:       ptr.To(corev1.PersistentVolumeBlock),
 		},
 	}
 
-	err := v.clients.runtimeClient.Create(ctx, pvc)
-	if err != nil {
-		return nil, fmt.Errorf("error creating pvc for virtualmachine: %w", err)
-	}
-	return pvc, nil
+	return pvc
 }
 
-// for non longhorn v1 engines we will create a datavolume from image volume
-// the pvc associated with datavolume is subsequently used to boot the vm
-func (v *ValidationRun) createDataVolume(ctx context.Context) (*corev1.PersistentVolumeClaim, error) {
+// newBootDataVolume defines a datavolume cloned from the golden pvc of the vmimage
+func (v *ValidationRun) newBootDataVolume(imageName string) *cdiv1.DataVolume {
 	dvObj := &cdiv1.DataVolume{
 		ObjectMeta: metav1.ObjectMeta{
 			GenerateName: "vm-storage-validation-",
@@ -168,7 +271,7 @@ func (v *ValidationRun) createDataVolume(ctx context.Context) (*corev1.Persisten
 			Source: &cdiv1.DataVolumeSource{
 				PVC: &cdiv1.DataVolumeSourcePVC{
 					// when a vmimage is created a golden pvc with same name is created and we use the same
-					Name:      v.vmImageName,
+					Name:      imageName,
 					Namespace: v.Configuration.Namespace,
 				},
 			},
@@ -178,35 +281,5 @@ func (v *ValidationRun) createDataVolume(ctx context.Context) (*corev1.Persisten
 		},
 	}
 
-	// wait for datavolume to be marked ready
-	err := v.clients.runtimeClient.Create(ctx, dvObj)
-	if err != nil {
-		return nil, fmt.Errorf("error creating datavolume for vm: %w", err)
-	}
-
-	v.createdObjects = append(v.createdObjects, dvObj)
-
-	// check if datavolume is ready
-	isDataVolumeReady := func(obj client.Object) (bool, error) {
-		dvObj, ok := obj.(*cdiv1.DataVolume)
-		if !ok {
-			return false, fmt.Errorf("error asserting object %v to datavolume", client.ObjectKeyFromObject(obj))
-		}
-
-		for _, condition := range dvObj.Status.Conditions {
-			if condition.Type == cdiv1.DataVolumeReady && condition.Status == corev1.ConditionTrue {
-				return true, nil
-			}
-		}
-		return false, nil
-	}
-
-	// wait until datavolume is ready
-	if err := v.waitUntilObjectIsReady(ctx, dvObj, isDataVolumeReady); err != nil {
-		return nil, err
-	}
-
-	pvcObj := &corev1.PersistentVolumeClaim{}
-	err = v.clients.runtimeClient.Get(ctx, types.NamespacedName{Name: dvObj.Name, Namespace: dvObj.Namespace}, pvcObj)
-	return pvcObj, err
+	return dvObj
 }
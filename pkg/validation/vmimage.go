@@ -11,6 +11,47 @@ import (
 )
 
 func (v *ValidationRun) createVMImage(ctx context.Context) error {
+	vmImage := v.newVMImage()
+
+	// submit vmimage request
+	if err := v.clients.runtimeClient.Create(ctx, vmImage); err != nil {
+		return fmt.Errorf("error creating vmimage: %w", err)
+	}
+
+	v.createdObjects = append(v.createdObjects, vmImage)
+	v.vmImageName = vmImage.Name //store vmimage details as it will be used later to create vm
+
+	// wait until VMImage is ready
+	if err := v.waitUntilObjectIsReady(ctx, vmImage, verifyVMImageImported); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// verify VMImage is ready
+func verifyVMImageImported(obj client.Object) (bool, error) {
+	vmImageObj, ok := obj.(*harvesterv1beta1.VirtualMachineImage)
+	if !ok {
+		return false, fmt.Errorf("error asserting object %v to vmimage", client.ObjectKeyFromObject(obj))
+	}
+
+	for _, condition := range vmImageObj.Status.Conditions {
+		if condition.Type == harvesterv1beta1.ImageImported && condition.Status == corev1.ConditionTrue {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (v *ValidationRun) planCreateVMImage() []client.Object {
+	vmImage := v.newVMImage()
+	v.vmImageName = plannedName(vmImage)
+	return []client.Object{vmImage}
+}
+
+// newVMImage defines a vmimage backed by the storage class under validation
+func (v *ValidationRun) newVMImage() *harvesterv1beta1.VirtualMachineImage {
 	vmImage := &harvesterv1beta1.VirtualMachineImage{
 		ObjectMeta: metav1.ObjectMeta{
 			GenerateName: "vmimage-storage-validation-",
@@ -20,6 +61,7 @@ func (v *ValidationRun) createVMImage(ctx context.Context) error {
 			DisplayName:            "storage-validation-test-image",
 			TargetStorageClassName: v.Configuration.StorageClass,
 			URL:                    v.Configuration.ImageURL,
+			Checksum:               v.Configuration.ImageChecksum,
 			SourceType:             harvesterv1beta1.VirtualMachineImageSourceTypeDownload,
 			Retry:                  3,
 		},
@@ -32,33 +74,5 @@ func (v *ValidationRun) createVMImage(ctx context.Context) error {
 		vmImage.Spec.Backend = harvesterv1beta1.VMIBackendCDI
 	}
 
-	// submit vmimage request
-	if err := v.clients.runtimeClient.Create(ctx, vmImage); err != nil {
-		return fmt.Errorf("error creating vmimage: %w", err)
-	}
-
-	v.createdObjects = append(v.createdObjects, vmImage)
-	v.vmImageName = vmImage.Name //store vmimage details as it will be used later to create vm
-
-	// verify VMImage is ready
-	checkVMImage := func(obj client.Object) (bool, error) {
-		vmImageObj, ok := obj.(*harvesterv1beta1.VirtualMachineImage)
-		if !ok {
-			return false, fmt.Errorf("error asserting object %v to vmimage", client.ObjectKeyFromObject(obj))
-		}
-
-		for _, condition := range vmImageObj.Status.Conditions {
-			if condition.Type == harvesterv1beta1.ImageImported && condition.Status == corev1.ConditionTrue {
-				return true, nil
-			}
-		}
-		return false, nil
-	}
-
-	// wait until VMImage is ready
-	if err := v.waitUntilObjectIsReady(ctx, vmImage, checkVMImage); err != nil {
-		return err
-	}
-
-	return nil
+	return vmImage
 }
@@ -0,0 +1,183 @@
+package validation
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	kubevirtv1 "kubevirt.io/api/core/v1"
+)
+
+const vmPersistenceMarker = "/var/lib/sv-persistence-marker"
+
+// restartVM writes a marker to the boot disk of the validation vm, stops the vm and waits
+// for its volumes to be detached from the node, then starts it again, possibly on another
+// node, and verifies the marker survived the restart
+func (v *ValidationRun) restartVM(ctx context.Context) error {
+	guest, err := v.openGuestSession(ctx, v.vmName)
+	if err != nil {
+		return err
+	}
+	marker := randomToken()
+	_, err = guest.run(ctx, fmt.Sprintf("echo %s > %s && sync", marker, vmPersistenceMarker))
+	guest.close()
+	if err != nil {
+		return fmt.Errorf("error writing marker to guest: %w", err)
+	}
+
+	sourceNode, err := v.vmiNodeName(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := v.stopVM(ctx); err != nil {
+		return err
+	}
+
+	if err := v.waitForVolumeDetach(ctx); err != nil {
+		return err
+	}
+
+	if err := v.startVM(ctx); err != nil {
+		return err
+	}
+
+	targetNode, err := v.vmiNodeName(ctx)
+	if err != nil {
+		return err
+	}
+	logrus.Infof("restarted vm %s, moved from node %s to %s", v.vmName, sourceNode, targetNode)
+
+	guest, err = v.openGuestSession(ctx, v.vmName)
+	if err != nil {
+		return err
+	}
+	defer guest.close()
+
+	output, err := guest.run(ctx, "cat "+vmPersistenceMarker)
+	if err != nil {
+		return fmt.Errorf("error reading marker from guest after restart: %w", err)
+	}
+	if strings.TrimSpace(output) != marker {
+		return fmt.Errorf("marker written before restart was not found in guest, expected %q, found %q", marker, strings.TrimSpace(output))
+	}
+	return nil
+}
+
+// waitForVolumeDetach waits until the vmi of the validation vm is removed, and then until the
+// VolumeAttachments of every pvc used by the vm, including hot plugged ones, are removed. the
+// attachments are listed again once each is removed, until none are left for the vm volumes
+func (v *ValidationRun) waitForVolumeDetach(ctx context.Context) error {
+	vmiObj := &kubevirtv1.VirtualMachineInstance{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      v.vmName,
+			Namespace: v.Configuration.Namespace,
+		},
+	}
+	if err := v.waitUntilObjectIsDeleted(ctx, vmiObj); err != nil {
+		return err
+	}
+
+	pvNames, err := v.vmVolumeNames(ctx)
+	if err != nil {
+		return err
+	}
+
+	for {
+		attachmentList := &storagev1.VolumeAttachmentList{}
+		if err := v.clients.runtimeClient.List(ctx, attachmentList); err != nil {
+			return fmt.Errorf("error listing volumeattachments: %w", err)
+		}
+
+		var attachment *storagev1.VolumeAttachment
+		for i := range attachmentList.Items {
+			pvName := attachmentList.Items[i].Spec.Source.PersistentVolumeName
+			if pvName != nil && pvNames[*pvName] {
+				attachment = &attachmentList.Items[i]
+				break
+			}
+		}
+		if attachment == nil {
+			return nil
+		}
+		if err := v.waitUntilObjectIsDeleted(ctx, attachment); err != nil {
+			return fmt.Errorf("volume %s was not detached from node %s after the vm stopped: %w", *attachment.Spec.Source.PersistentVolumeName, attachment.Spec.NodeName, err)
+		}
+	}
+}
+
+// vmVolumeNames returns the names of the pvs bound to the pvcs and datavolumes used by the
+// validation vm, which include hot plugged volumes
+func (v *ValidationRun) vmVolumeNames(ctx context.Context) (map[string]bool, error) {
+	vmObj := &kubevirtv1.VirtualMachine{}
+	if err := v.clients.runtimeClient.Get(ctx, types.NamespacedName{Name: v.vmName, Namespace: v.Configuration.Namespace}, vmObj); err != nil {
+		return nil, fmt.Errorf("error looking up vm %s: %w", v.vmName, err)
+	}
+
+	pvNames := map[string]bool{}
+	for _, volume := range vmObj.Spec.Template.Spec.Volumes {
+		var pvcName string
+		switch {
+		case volume.PersistentVolumeClaim != nil:
+			pvcName = volume.PersistentVolumeClaim.ClaimName
+		case volume.DataVolume != nil:
+			// the pvc of a datavolume has the same name
+			pvcName = volume.DataVolume.Name
+		default:
+			continue
+		}
+
+		pvc := &corev1.PersistentVolumeClaim{}
+		if err := v.clients.runtimeClient.Get(ctx, types.NamespacedName{Name: pvcName, Namespace: v.Configuration.Namespace}, pvc); err != nil {
+			return nil, fmt.Errorf("error looking up pvc %s: %w", pvcName, err)
+		}
+		if pvc.Spec.VolumeName != "" {
+			pvNames[pvc.Spec.VolumeName] = true
+		}
+	}
+	return pvNames, nil
+}
+
+// vmiNodeName returns the node running the validation vmi
+func (v *ValidationRun) vmiNodeName(ctx context.Context) (string, error) {
+	vmiObj := &kubevirtv1.VirtualMachineInstance{}
+	if err := v.clients.runtimeClient.Get(ctx, types.NamespacedName{Name: v.vmName, Namespace: v.Configuration.Namespace}, vmiObj); err != nil {
+		return "", fmt.Errorf("error looking up vmi %s: %w", v.vmName, err)
+	}
+	return vmiObj.Status.NodeName, nil
+}
+
+// stopVM stops the validation vm through the stop subresource, and waits until the vmi is removed
+func (v *ValidationRun) stopVM(ctx context.Context) error {
+	if err := v.clients.kubevirtClient.VirtualMachine(v.Configuration.Namespace).Stop(ctx, v.vmName, &kubevirtv1.StopOptions{}); err != nil {
+		return fmt.Errorf("error stopping vm %s: %w", v.vmName, err)
+	}
+
+	vmiObj := &kubevirtv1.VirtualMachineInstance{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      v.vmName,
+			Namespace: v.Configuration.Namespace,
+		},
+	}
+	return v.waitUntilObjectIsDeleted(ctx, vmiObj)
+}
+
+// startVM starts the validation vm through the start subresource, and waits until it is running
+func (v *ValidationRun) startVM(ctx context.Context) error {
+	if err := v.clients.kubevirtClient.VirtualMachine(v.Configuration.Namespace).Start(ctx, v.vmName, &kubevirtv1.StartOptions{}); err != nil {
+		return fmt.Errorf("error starting vm %s: %w", v.vmName, err)
+	}
+
+	vmObj := &kubevirtv1.VirtualMachine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      v.vmName,
+			Namespace: v.Configuration.Namespace,
+		},
+	}
+	return v.waitUntilObjectIsReady(ctx, vmObj, verifyVMIsRunning)
+}
@@ -3,26 +3,73 @@ package validation
 import (
 	"context"
 	"fmt"
+	"strconv"
+	"strings"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/utils/ptr"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/harvester/storage-validator/pkg/api"
+)
+
+const (
+	// probeMountPath is where probe pods mount the pvc under validation
+	probeMountPath = "/data"
+	probeContainer = "probe"
 )
 
 func (v *ValidationRun) createVolume(ctx context.Context) error {
+	pvc := v.newBaselinePVC("pvc-storage-validation-")
+
+	// need to create pvc
+	err := v.clients.runtimeClient.Create(ctx, pvc)
+	if err != nil {
+		return fmt.Errorf("error creating pvc: %w", err)
+	}
+
+	// store for cleanup later on
+	v.createdObjects = append(v.createdObjects, pvc)
+	v.pvcName = pvc.Name
+	// attach pvc to pod to ensure creation
+	pod := v.newProbePod("pvc-storage-validation-", pvc.Name)
+
+	err = v.clients.runtimeClient.Create(ctx, pod)
+	if err != nil {
+		return fmt.Errorf("error creating pvc: %w", err)
+	}
+	v.createdObjects = append(v.createdObjects, pod)
+
+	if err := v.waitUntilObjectIsReady(ctx, pod, verifyPodIsReady); err != nil {
+		return err
+	}
 
-	pvc := &corev1.PersistentVolumeClaim{
+	if err := v.waitUntilObjectIsReady(ctx, pvc, verifyPVCIsBound); err != nil {
+		return err
+	}
+	return v.verifyProbePodVolume(ctx, pod)
+}
+
+func (v *ValidationRun) planCreateVolume() []client.Object {
+	pvc := v.newBaselinePVC("pvc-storage-validation-")
+	v.pvcName = plannedName(pvc)
+	return []client.Object{pvc, v.newProbePod("pvc-storage-validation-", v.pvcName)}
+}
+
+// newBaselinePVC defines a filesystem pvc using the storage class under validation
+func (v *ValidationRun) newBaselinePVC(generateName string) *corev1.PersistentVolumeClaim {
+	return &corev1.PersistentVolumeClaim{
 		ObjectMeta: metav1.ObjectMeta{
-			GenerateName: "pvc-storage-validation-",
+			GenerateName: generateName,
 			Namespace:    v.Configuration.Namespace,
 			Labels: map[string]string{
 				baselinePVCLabelKey: "true",
 			},
 		},
 		Spec: corev1.PersistentVolumeClaimSpec{
-			AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteMany},
+			AccessModes:      []corev1.PersistentVolumeAccessMode{v.volumeAccessMode()},
 			StorageClassName: ptr.To(v.Configuration.StorageClass),
 			Resources: corev1.VolumeResourceRequirements{
 				Requests: map[corev1.ResourceName]resource.Quantity{
@@ -31,27 +78,28 @@ func (v *ValidationRun) createVolume(ctx context.Context) error {
 			},
 		},
 	}
+}
 
-	// need to create pvc
-	err := v.clients.runtimeClient.Create(ctx, pvc)
-	if err != nil {
-		return fmt.Errorf("error creating pvc: %w", err)
-	}
-
-	// store for cleanup later on
-	v.createdObjects = append(v.createdObjects, pvc)
-	v.pvcName = pvc.Name
-	// attach pvc to pod to ensure creation
+// newProbePod defines a pod which mounts the pvc to ensure it can be attached and used
+func (v *ValidationRun) newProbePod(generateName, pvcName string) *corev1.Pod {
+	workload := v.Configuration.Workload
 	pod := &corev1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
-			GenerateName: "pvc-storage-validation-",
+			GenerateName: generateName,
 			Namespace:    v.Configuration.Namespace,
 		},
 		Spec: corev1.PodSpec{
 			Containers: []corev1.Container{
 				{
-					Name:  "nginx",
-					Image: "registry.suse.com/suse/nginx:1.21",
+					Name:      probeContainer,
+					Image:     workload.Image,
+					Resources: workload.Resources,
+					VolumeMounts: []corev1.VolumeMount{
+						{
+							Name:      "pvc-storage-validation",
+							MountPath: probeMountPath,
+						},
+					},
 				},
 			},
 			Volumes: []corev1.Volume{
@@ -59,42 +107,53 @@ func (v *ValidationRun) createVolume(ctx context.Context) error {
 					Name: "pvc-storage-validation",
 					VolumeSource: corev1.VolumeSource{
 						PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
-							ClaimName: pvc.Name,
+							ClaimName: pvcName,
 						},
 					},
 				},
 			},
 		},
 	}
+	v.applyWorkloadScheduling(&pod.Spec)
+	return pod
+}
 
-	err = v.clients.runtimeClient.Create(ctx, pod)
-	if err != nil {
-		return fmt.Errorf("error creating pvc: %w", err)
-	}
-	v.createdObjects = append(v.createdObjects, pod)
-
-	if err := v.waitUntilObjectIsReady(ctx, pod, verifyPodIsReady); err != nil {
-		return err
-	}
-
-	if err := v.waitUntilObjectIsReady(ctx, pvc, verifyPVCIsBound); err != nil {
-		return err
+// applyWorkloadScheduling applies the image pull secrets and scheduling constraints
+// from the workload configuration to pods created by the validator
+func (v *ValidationRun) applyWorkloadScheduling(spec *corev1.PodSpec) {
+	workload := v.Configuration.Workload
+	spec.NodeSelector = workload.NodeSelector
+	spec.Tolerations = workload.Tolerations
+	for _, secret := range workload.ImagePullSecrets {
+		spec.ImagePullSecrets = append(spec.ImagePullSecrets, corev1.LocalObjectReference{Name: secret})
 	}
-	return nil
 }
 
-// reconcile until pod is running and ensure pvc is bound
+// reconcile until pod is running and its containers are ready. a pod which
+// has terminated will not become ready, so there is no point waiting for it
 func verifyPodIsReady(obj client.Object) (bool, error) {
 	podObj, ok := obj.(*corev1.Pod)
 	if !ok {
 		return false, fmt.Errorf("error asserting object %v to pod", client.ObjectKeyFromObject(obj))
 	}
-	if podObj.Status.Phase != corev1.PodRunning {
-		return true, nil
+	switch podObj.Status.Phase {
+	case corev1.PodRunning:
+		return podReady(podObj), nil
+	case corev1.PodSucceeded, corev1.PodFailed:
+		return false, fmt.Errorf("pod %s is %s: %s", podObj.Name, podObj.Status.Phase, describeObjectStatus(podObj))
 	}
 	return false, nil
 }
 
+func podReady(pod *corev1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
 // verify PVC is Bound
 func verifyPVCIsBound(obj client.Object) (bool, error) {
 	pvcObj, ok := obj.(*corev1.PersistentVolumeClaim)
@@ -106,3 +165,62 @@ func verifyPVCIsBound(obj client.Object) (bool, error) {
 	}
 	return false, nil
 }
+
+// verifyProbePodVolume writes random data to the volume mounted by the probe pod, flushes it
+// and reads it back bypassing the page cache to ensure the checksum matches. the filesystem
+// type, mount options and free space of the volume are added to the report
+func (v *ValidationRun) verifyProbePodVolume(ctx context.Context, pod *corev1.Pod) error {
+	output, err := v.execInPod(ctx, pod, probeContainer, []string{"sh", "-c", probeVolumeScript()})
+	if err != nil {
+		return fmt.Errorf("error verifying read and write to volume in pod %s: %w", pod.Name, err)
+	}
+
+	result, err := parseProbeVolumeOutput(output)
+	if err != nil {
+		return fmt.Errorf("error verifying read and write to volume in pod %s: %w", pod.Name, err)
+	}
+	result.PVC = pod.Spec.Volumes[0].PersistentVolumeClaim.ClaimName
+	result.Node = pod.Spec.NodeName
+	v.Report.VolumeProbes = append(v.Report.VolumeProbes, result)
+	return nil
+}
+
+// probeVolumeScript prints the mount of the volume followed by its df output, once
+// the data read back matches the data written
+func probeVolumeScript() string {
+	return fmt.Sprintf(`set -e; f=%[1]s/.storage-validation; dd if=/dev/urandom of=/tmp/probe bs=1M count=16 status=none; `+
+		`dd if=/tmp/probe of=$f bs=1M conv=fsync status=none; `+
+		`[ "$(md5sum < /tmp/probe)" = "$(dd if=$f bs=1M iflag=direct status=none | md5sum)" ] || { echo "checksum of data read back does not match data written" >&2; exit 1; }; `+
+		`rm -f $f /tmp/probe; `+
+		`while read dev mnt fs opts rest; do [ "$mnt" = %[1]s ] && echo "$fs $opts"; done < /proc/mounts; df -Pk %[1]s | tail -n 1`, probeMountPath)
+}
+
+// parseProbeVolumeOutput parses the mount and df lines printed by probeVolumeScript
+func parseProbeVolumeOutput(output string) (api.VolumeProbeResult, error) {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) < 2 {
+		return api.VolumeProbeResult{}, fmt.Errorf("unexpected probe output: %q", output)
+	}
+
+	mount := strings.Fields(lines[len(lines)-2])
+	df := strings.Fields(lines[len(lines)-1])
+	if len(mount) < 2 || len(df) < 4 {
+		return api.VolumeProbeResult{}, fmt.Errorf("unexpected probe output: %q", output)
+	}
+
+	capacityKB, err := strconv.ParseInt(df[1], 10, 64)
+	if err != nil {
+		return api.VolumeProbeResult{}, fmt.Errorf("unexpected df output: %q", lines[len(lines)-1])
+	}
+	availableKB, err := strconv.ParseInt(df[3], 10, 64)
+	if err != nil {
+		return api.VolumeProbeResult{}, fmt.Errorf("unexpected df output: %q", lines[len(lines)-1])
+	}
+
+	return api.VolumeProbeResult{
+		FilesystemType: mount[0],
+		MountOptions:   mount[1],
+		CapacityBytes:  capacityKB * 1024,
+		AvailableBytes: availableKB * 1024,
+	}, nil
+}
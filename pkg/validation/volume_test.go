@@ -0,0 +1,46 @@
+package validation
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/harvester/storage-validator/pkg/api"
+)
+
+func Test_ParseProbeVolumeOutput(t *testing.T) {
+	assert := require.New(t)
+	output := "ext4 rw,relatime\n/dev/longhorn/pvc-3f2c 10218772 24 10202364 1% /data\n"
+	result, err := parseProbeVolumeOutput(output)
+	assert.NoError(err)
+	assert.Equal(api.VolumeProbeResult{
+		FilesystemType: "ext4",
+		MountOptions:   "rw,relatime",
+		CapacityBytes:  10218772 * 1024,
+		AvailableBytes: 10202364 * 1024,
+	}, result)
+
+	_, err = parseProbeVolumeOutput("/dev/sdb 10218772 24 10202364 1% /data\n")
+	assert.Error(err)
+}
+
+func Test_VerifyPodIsReady(t *testing.T) {
+	assert := require.New(t)
+	pod := &corev1.Pod{}
+
+	pod.Status.Phase = corev1.PodPending
+	ready, err := verifyPodIsReady(pod)
+	assert.NoError(err)
+	assert.False(ready)
+
+	pod.Status.Phase = corev1.PodRunning
+	pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+	ready, err = verifyPodIsReady(pod)
+	assert.NoError(err)
+	assert.True(ready)
+
+	pod.Status.Phase = corev1.PodFailed
+	_, err = verifyPodIsReady(pod)
+	assert.Error(err)
+}
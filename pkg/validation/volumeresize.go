@@ -6,31 +6,11 @@ import (
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/utils/ptr"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 func (v *ValidationRun) volumeOfflineResize(ctx context.Context) error {
-
-	pvc := &corev1.PersistentVolumeClaim{
-		ObjectMeta: metav1.ObjectMeta{
-			GenerateName: "volume-resize-storage-validation-",
-			Namespace:    v.Configuration.Namespace,
-			Labels: map[string]string{
-				baselinePVCLabelKey: "true",
-			},
-		},
-		Spec: corev1.PersistentVolumeClaimSpec{
-			AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteMany},
-			StorageClassName: ptr.To(v.Configuration.StorageClass),
-			Resources: corev1.VolumeResourceRequirements{
-				Requests: map[corev1.ResourceName]resource.Quantity{
-					corev1.ResourceStorage: resource.MustParse(DefaultPVCSize),
-				},
-			},
-		},
-	}
+	pvc := v.newBaselinePVC("volume-resize-storage-validation-")
 
 	// need to create pvc
 	err := v.clients.runtimeClient.Create(ctx, pvc)
@@ -41,30 +21,7 @@ func (v *ValidationRun) volumeOfflineResize(ctx context.Context) error {
 	// store for cleanup later on
 	v.createdObjects = append(v.createdObjects, pvc)
 	// attach pvc to pod to ensure creation
-	pod := &corev1.Pod{
-		ObjectMeta: metav1.ObjectMeta{
-			GenerateName: "volume-resize-storage-validation-",
-			Namespace:    v.Configuration.Namespace,
-		},
-		Spec: corev1.PodSpec{
-			Containers: []corev1.Container{
-				{
-					Name:  "nginx",
-					Image: "registry.suse.com/suse/nginx:1.21",
-				},
-			},
-			Volumes: []corev1.Volume{
-				{
-					Name: "pvc-storage-validation",
-					VolumeSource: corev1.VolumeSource{
-						PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
-							ClaimName: pvc.Name,
-						},
-					},
-				},
-			},
-		},
-	}
+	pod := v.newProbePod("volume-resize-storage-validation-", pvc.Name)
 
 	err = v.clients.runtimeClient.Create(ctx, pod)
 	if err != nil {
@@ -79,6 +36,10 @@ func (v *ValidationRun) volumeOfflineResize(ctx context.Context) error {
 		return err
 	}
 
+	if err := v.verifyProbePodVolume(ctx, pod); err != nil {
+		return err
+	}
+
 	// delete pod as we need to trigger offline expansion
 	if err := v.clients.runtimeClient.Delete(ctx, pod); err != nil {
 		return fmt.Errorf("error deleting pod: %w", err)
@@ -115,6 +76,11 @@ func (v *ValidationRun) volumeOfflineResize(ctx context.Context) error {
 	return nil
 }
 
+func (v *ValidationRun) planVolumeOfflineResize() []client.Object {
+	pvc := v.newBaselinePVC("volume-resize-storage-validation-")
+	return []client.Object{pvc, v.newProbePod("volume-resize-storage-validation-", plannedName(pvc))}
+}
+
 func IsFSResizeRequired(pvc *corev1.PersistentVolumeClaim) bool {
 	for _, condition := range pvc.Status.Conditions {
 		if condition.Type == corev1.PersistentVolumeClaimFileSystemResizePending && condition.Status == corev1.ConditionTrue {